@@ -0,0 +1,85 @@
+package scrape
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// LinkCheck is the result of checking an url without crawling it
+type LinkCheck struct {
+	URL         string        // URL that is checked
+	StatusCode  int           // StatusCode of the response. 0 if the url couldn't be fetched
+	RedirectURL string        // RedirectURL is the final url if the url redirected
+	Latency     time.Duration // Latency of the check
+	Err         error         // Err is the reason the link is broken. nil if the link is fine
+}
+
+// Broken says if the link is broken
+func (lc *LinkCheck) Broken() bool {
+	return lc.Err != nil
+}
+
+// checkURL checks the url with HEAD falling back to GET if HEAD is not allowed
+func checkURL(client *http.Client, depth int, u *url.URL) (md *minionDump) {
+	lc := &LinkCheck{URL: u.String()}
+	st := time.Now()
+	resp, err := client.Head(u.String())
+	if err == nil && resp.StatusCode == http.StatusMethodNotAllowed {
+		resp.Body.Close()
+		resp, err = client.Get(u.String())
+	}
+	lc.Latency = time.Since(st)
+
+	md = &minionDump{
+		depth:     depth + 1,
+		sourceURL: u,
+		check:     lc,
+		latency:   lc.Latency,
+	}
+
+	if err != nil {
+		lc.Err = &FetchError{URL: u.String(), Err: err}
+		return md
+	}
+	defer resp.Body.Close()
+
+	lc.StatusCode = resp.StatusCode
+	if final := resp.Request.URL.String(); final != lc.URL {
+		lc.RedirectURL = final
+	}
+
+	if resp.StatusCode >= 400 {
+		lc.Err = &HTTPStatusError{URL: u.String(), Code: resp.StatusCode}
+	}
+
+	return md
+}
+
+// queueChecks queues the urls found on the source page to be checked if not queued already
+func queueChecks(g *gru, depth int, source string, urls []*url.URL) {
+	for _, u := range urls {
+		if g.checkQueued[u.String()] {
+			continue
+		}
+
+		g.checkQueued[u.String()] = true
+		pushURLs(g.unChecked, depth, source, u)
+	}
+}
+
+// brokenLinks returns the links pointing to the urls that failed to crawl or failed the check
+func brokenLinks(r Response) (links []Link) {
+	for _, l := range r.Links {
+		if _, ok := r.ErrorURLs[l.Target]; ok {
+			links = append(links, l)
+			continue
+		}
+
+		if lc, ok := r.CheckedURLs[l.Target]; ok && lc.Broken() {
+			links = append(links, l)
+		}
+	}
+
+	return links
+}
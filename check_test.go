@@ -0,0 +1,104 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func externalServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			fmt.Fprint(w, `<a href="/not-crawled">not crawled</a>`)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func Test_checkURL(t *testing.T) {
+	es := externalServer()
+	defer es.Close()
+
+	tests := []struct {
+		path     string
+		status   int
+		redirect string
+		broken   bool
+	}{
+		{path: "/ok", status: http.StatusOK},
+		{path: "/no-head", status: http.StatusOK},
+		{path: "/moved", status: http.StatusOK, redirect: es.URL + "/ok"},
+		{path: "/missing", status: http.StatusNotFound, broken: true},
+	}
+
+	for _, c := range tests {
+		u, _ := url.Parse(es.URL + c.path)
+		md := checkURL(http.DefaultClient, 1, u)
+		lc := md.check
+		if lc.StatusCode != c.status || lc.RedirectURL != c.redirect || lc.Broken() != c.broken {
+			t.Fatalf("expected %d %q broken(%t) for %s but got %+v", c.status, c.redirect, c.broken, c.path, lc)
+		}
+
+		if md.depth != 2 || md.sourceURL != u || len(md.urls) != 0 {
+			t.Fatalf("unexpected dump: %+v", md)
+		}
+	}
+}
+
+func TestCrawler_RunWithLinkCheck(t *testing.T) {
+	es := externalServer()
+	defer es.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<a href="/page">page</a><a href="%[1]s/ok">ok</a><a href="%[1]s/missing">missing</a>`, es.URL)
+		case "/page":
+			fmt.Fprintf(w, `<a href="%[1]s/moved">moved</a><a href="%[1]s/missing">missing</a><a href="/deep">deep</a>`, es.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	// crawl on localhost and treat 127.0.0.1 as external
+	seed := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1) + "/"
+	resp, err := New(WithLinkCheck(true), WithMaxDepth(2), WithDomainRegex("^localhost$"), WithIgnoreRobots(true)).Run(context.Background(), seed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(resp.CheckedURLs) != 4 {
+		t.Fatalf("expected 4 checked urls but got %v", resp.CheckedURLs)
+	}
+
+	if _, ok := resp.CheckedURLs[es.URL+"/not-crawled"]; ok {
+		t.Fatal("expected checked urls to not be crawled")
+	}
+
+	if lc := resp.CheckedURLs[seed+"deep"]; lc == nil || !lc.Broken() {
+		t.Fatalf("expected url at max depth to be checked and broken but got %+v", lc)
+	}
+
+	broken := resp.BrokenLinks()
+	if len(broken) != 3 {
+		t.Fatalf("expected 3 broken links but got %v", broken)
+	}
+
+	if r := resp.Referrers(es.URL + "/missing"); len(r) != 2 {
+		t.Fatalf("expected 2 referrers of the missing url but got %v", r)
+	}
+}
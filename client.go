@@ -0,0 +1,80 @@
+package scrape
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultUserAgent      = "Scrape/1.0"     // defaultUserAgent sent with the requests
+	defaultConnectTimeout = 10 * time.Second // defaultConnectTimeout to establish the connection
+	defaultReadTimeout    = 30 * time.Second // defaultReadTimeout to wait for the response headers
+	defaultTimeout        = 60 * time.Second // defaultTimeout for the whole request including the body
+)
+
+// defaultClient returns a http client with connect and read timeouts
+// instead of the unbounded http.DefaultClient
+func defaultClient() *http.Client {
+	return &http.Client{
+		Timeout: defaultTimeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   defaultConnectTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   defaultConnectTimeout,
+			ResponseHeaderTimeout: defaultReadTimeout,
+			ExpectContinueTimeout: time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   10,
+		},
+	}
+}
+
+// userAgentTransport sets the User-Agent header on requests that do not have one
+type userAgentTransport struct {
+	userAgent string
+	transport http.RoundTripper
+}
+
+// RoundTrip sets the user agent and proxies the request to underlying transport
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+
+	return t.transport.RoundTrip(req)
+}
+
+// httpClient returns the client minions should use with the crawler's transport, timeout and user agent applied.
+// The configured client is copied so that the caller's client is never modified
+func httpClient(c *Crawler) *http.Client {
+	client := c.client
+	if client == nil {
+		client = defaultClient()
+	}
+
+	cc := *client
+	if c.transport != nil {
+		cc.Transport = c.transport
+	}
+
+	if c.timeout > 0 {
+		cc.Timeout = c.timeout
+	}
+
+	if c.userAgent != "" {
+		transport := cc.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+
+		cc.Transport = userAgentTransport{userAgent: c.userAgent, transport: transport}
+	}
+
+	return &cc
+}
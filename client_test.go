@@ -0,0 +1,89 @@
+package scrape
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTransport records the urls requested through it
+type recordingTransport struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.urls = append(rt.urls, req.URL.String())
+	rt.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func Test_httpClient(t *testing.T) {
+	userClient := &http.Client{Timeout: time.Second}
+	rt := &recordingTransport{}
+	tests := []struct {
+		c         *Crawler
+		timeout   time.Duration
+		transport http.RoundTripper
+	}{
+		{
+			c:       New(),
+			timeout: defaultTimeout,
+		},
+
+		{
+			c:       New(WithHTTPClient(userClient)),
+			timeout: time.Second,
+		},
+
+		{
+			c:         New(WithHTTPClient(userClient), WithTransport(rt), WithTimeout(time.Minute)),
+			timeout:   time.Minute,
+			transport: rt,
+		},
+	}
+
+	for _, c := range tests {
+		client := httpClient(c.c)
+		if client.Timeout != c.timeout {
+			t.Fatalf("expected timeout %v but got %v", c.timeout, client.Timeout)
+		}
+
+		uat, ok := client.Transport.(userAgentTransport)
+		if !ok || uat.userAgent != defaultUserAgent {
+			t.Fatal("expected user agent transport")
+		}
+
+		if c.transport != nil && uat.transport != c.transport {
+			t.Fatal("expected transport to be overridden")
+		}
+	}
+
+	if userClient.Timeout != time.Second || userClient.Transport != nil {
+		t.Fatal("user client is modified")
+	}
+}
+
+func TestCrawler_RunWithTransport(t *testing.T) {
+	ts := testServer()
+	defer ts.Close()
+
+	rt := &recordingTransport{}
+	_, err := New(WithTransport(rt)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fetched := make(map[string]bool)
+	for _, u := range rt.urls {
+		fetched[u] = true
+	}
+
+	// 4 pages and robots.txt
+	if len(fetched) != 5 {
+		t.Fatalf("expected 5 urls to be fetched through transport but got %v", rt.urls)
+	}
+}
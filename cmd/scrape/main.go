@@ -2,47 +2,373 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/vedhavyas/scrape"
 )
 
+// jsonRecord is a single line of the records streamed as JSON Lines
+type jsonRecord struct {
+	URL    string        `json:"url"`
+	Record scrape.Record `json:"record"`
+}
+
+// streamRecords returns the hooks writing the records extracted from the pages to w as JSON Lines
+func streamRecords(w io.Writer) scrape.Hooks {
+	enc := json.NewEncoder(w)
+	return scrape.Hooks{OnPage: func(p *scrape.Page) {
+		if p.Record == nil {
+			return
+		}
+
+		err := enc.Encode(jsonRecord{URL: p.FinalURL, Record: p.Record})
+		if err != nil {
+			log.Printf("failed to write record of %s: %v\n", p.FinalURL, err)
+		}
+	}}
+}
+
+// urlRulesFlag collects the repeatable include and exclude flags into the ordered url rules
+type urlRulesFlag struct {
+	rules   *[]*scrape.URLRule
+	exclude bool
+}
+
+// String returns the rules collected
+func (f urlRulesFlag) String() string {
+	if f.rules == nil {
+		return ""
+	}
+
+	var rules []string
+	for _, r := range *f.rules {
+		rules = append(rules, r.String())
+	}
+
+	return strings.Join(rules, ", ")
+}
+
+// Set parses the rule and adds it to the rules
+func (f urlRulesFlag) Set(spec string) error {
+	parse := scrape.Include
+	if f.exclude {
+		parse = scrape.Exclude
+	}
+
+	r, err := parse(spec)
+	if err != nil {
+		return err
+	}
+
+	*f.rules = append(*f.rules, r)
+	return nil
+}
+
+// changeFreqsFlag collects the repeatable changefreq flags into the ordered changefreq rules
+type changeFreqsFlag struct {
+	rules *[]*scrape.ChangeFreqRule
+}
+
+// String returns the rules as given
+func (f changeFreqsFlag) String() string {
+	if f.rules == nil {
+		return ""
+	}
+
+	var rules []string
+	for _, r := range *f.rules {
+		rules = append(rules, strings.TrimPrefix(r.Rule.String(), "include ")+"="+r.Freq)
+	}
+
+	return strings.Join(rules, ", ")
+}
+
+// Set parses the spec=freq rule and adds it to the rules
+func (f changeFreqsFlag) Set(value string) error {
+	i := strings.LastIndex(value, "=")
+	if i < 0 {
+		return fmt.Errorf("changefreq %s is not in spec=freq form", value)
+	}
+
+	r, err := scrape.ChangeFreq(value[:i], value[i+1:])
+	if err != nil {
+		return err
+	}
+
+	*f.rules = append(*f.rules, r)
+	return nil
+}
+
+// sitemapFlags are the flags configuring the sitemap written with -sitemap
+var sitemapFlags = []string{"sitemap-base-url", "sitemap-canonical-only", "sitemap-exclude-noindex", "sitemap-priority", "changefreq"}
+
+// flagConflict returns an error if the set flags would be ignored. check mode prints the broken links
+// only, so neither the sitemap nor the records are written
+func flagConflict(check bool, set map[string]bool) error {
+	if check {
+		for _, name := range append([]string{"sitemap", "rules"}, sitemapFlags...) {
+			if set[name] {
+				return fmt.Errorf("-%s cannot be used with check", name)
+			}
+		}
+	}
+
+	if !set["sitemap"] {
+		for _, name := range sitemapFlags {
+			if set[name] {
+				return fmt.Errorf("-%s requires -sitemap", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readSeeds returns the seed urls given as args followed by the ones in the file, if any. - reads stdin
+func readSeeds(file string, args []string) ([]string, error) {
+	seeds := append([]string(nil), args...)
+	if file == "" {
+		return seeds, nil
+	}
+
+	r := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	fs, err := scrape.ReadSeeds(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(seeds, fs...), nil
+}
+
+// printBrokenLinks prints the broken links along with their referrers and returns the count
+func printBrokenLinks(resp *scrape.Response) int {
+	links := resp.BrokenLinks()
+	for _, l := range links {
+		reason := ""
+		if err, ok := resp.ErrorURLs[l.Target]; ok {
+			reason = err.Error()
+		} else if lc, ok := resp.CheckedURLs[l.Target]; ok {
+			reason = lc.Err.Error()
+		}
+
+		fmt.Fprintf(os.Stdout, "%s -> %s (%s): %s\n", l.Source, l.Target, l.Text, reason)
+	}
+
+	fmt.Fprintf(os.Stdout, "%d broken links found\n", len(links))
+	return len(links)
+}
+
 func main() {
 	log.SetFlags(log.Ldate | log.Lshortfile)
 	flag.CommandLine.SetOutput(os.Stdout)
 
+	// check sub command checks the links instead of printing the response
+	args := os.Args[1:]
+	check := len(args) > 0 && args[0] == "check"
+	if check {
+		args = args[1:]
+	}
+
 	baseURL := flag.String("url", "https://vedhavyas.com", "Starting URL")
 	maxDepth := flag.Int("max-depth", -1, "Max depth to Crawl")
 	domainRegex := flag.String("domain-regex", "", "Domain regex to limit crawls to. Defaults to base url domain")
-	sitemapFile := flag.String("sitemap", "", "File location to write sitemap to")
+	workers := flag.Int("workers", runtime.NumCPU()*2, "Number of workers crawling the urls")
+	minWorkers := flag.Int("min-workers", 1, "Min workers to shrink to when auto scaling")
+	maxWorkers := flag.Int("max-workers", 0, "Max workers to grow to when auto scaling. 0 disables auto scaling")
+	timeout := flag.Duration("timeout", 0, "Timeout to fetch a single url. Defaults to 60s")
+	userAgent := flag.String("user-agent", "Scrape/1.0", "User agent to send and evaluate robots.txt for")
+	ignoreRobots := flag.Bool("ignore-robots", false, "Ignore robots.txt rules and crawl delay")
+	rate := flag.Float64("rate", 0, "Max requests per second to a single host. 0 means no limit")
+	perHostConcurrency := flag.Int("per-host-concurrency", 0, "Max in flight requests to a single host. 0 means no limit")
+	maxAttempts := flag.Int("max-attempts", scrape.DefaultRetryPolicy.MaxAttempts, "Max attempts to fetch an url failing transiently. 1 disables retries")
+	follow := flag.String("follow", "", "Comma separated kinds of links to follow, such as a[href],img[src]. Defaults to a[href],area[href],iframe[src],meta[http-equiv=refresh]")
+	followNofollow := flag.Bool("follow-nofollow", false, "Follow links marked rel=nofollow and links on pages with meta robots nofollow")
+	stripParams := flag.String("strip-params", strings.Join(scrape.DefaultTrackingParams, ","), "Comma separated query params stripped from the urls. Params ending with * match by prefix")
+	foldTrailingSlash := flag.Bool("fold-trailing-slash", false, "Treat urls with and without trailing slash as same")
+	maxRedirects := flag.Int("max-redirects", 10, "Max redirects to follow for a single url")
+	resume := flag.String("resume", "", "File to save the crawl state to and resume the crawl from if it exists")
+	checkpointInterval := flag.Duration("checkpoint-interval", 30*time.Second, "Interval to save the crawl state at when resume is given")
+	rulesFile := flag.String("rules", "", "YAML file with the extraction rules. Extracted records are streamed to stdout as JSON Lines")
+	var urlRules []*scrape.URLRule
+	flag.Var(urlRulesFlag{rules: &urlRules}, "include", "Include urls matching [url:|path:|query:][glob:]pattern. Repeatable, first matching include or exclude wins")
+	flag.Var(urlRulesFlag{rules: &urlRules, exclude: true}, "exclude", "Exclude urls matching [url:|path:|query:][glob:]pattern. Repeatable, first matching include or exclude wins")
+	maxPages := flag.Int("max-pages", 0, "Max pages to crawl in total. 0 means no limit")
+	maxPagesPerHost := flag.Int("max-pages-per-host", 0, "Max pages to crawl from a single host. 0 means no limit")
+	maxURLLength := flag.Int("max-url-length", 0, "Max length of the urls followed. 0 means no limit")
+	maxSegmentRepeats := flag.Int("max-segment-repeats", 0, "Max times a path segment can repeat in an url followed. 0 means no limit")
+	maxQueryVariants := flag.Int("max-query-variants", 0, "Max distinct queries followed for a single path. 0 means no limit")
+	maxDuration := flag.Duration("max-duration", 0, "Max duration of the crawl after which no new urls are crawled. 0 means no limit")
+	strategy := flag.String("strategy", "bfs", "Order to crawl the urls in: bfs, dfs, short-paths or inlinks")
+	seedsFile := flag.String("seeds", "", "File with the seed urls, one per line. - reads them from stdin")
+	sitemapSeeds := flag.Bool("sitemap-seeds", false, "Seed the crawl with the urls in the sitemaps found in robots.txt or at /sitemap.xml")
+	sitemapFile := flag.String("sitemap", "", "File location to write sitemap to. Files ending with .gz are gzipped")
+	sitemapBaseURL := flag.String("sitemap-base-url", "", "URL the sitemaps are served from, listed in the sitemap index when split. Defaults to the root of the base url")
+	sitemapCanonical := flag.Bool("sitemap-canonical-only", false, "List only the html pages crawled with 200 OK that are not canonicalized to another url")
+	sitemapNoindex := flag.Bool("sitemap-exclude-noindex", false, "Leave out the pages asking not to be indexed through meta robots or X-Robots-Tag")
+	sitemapPriority := flag.String("sitemap-priority", "", "Priority of the sitemap urls by depth or inlinks. Omitted by default")
+	var changeFreqs []*scrape.ChangeFreqRule
+	flag.Var(changeFreqsFlag{rules: &changeFreqs}, "changefreq", "Changefreq of the sitemap urls matching [url:|path:|query:][glob:]pattern=freq. Repeatable, first matching rule wins")
 	help := flag.Bool("help", false, "Show Options")
-	flag.Parse()
+	flag.CommandLine.Parse(args)
 
 	if *help {
-		fmt.Fprintf(os.Stdout, "Usage of %s:\n", os.Args[0])
+		fmt.Fprintf(os.Stdout, "Usage of %s [check] [seed urls...]:\n", os.Args[0])
 		flag.PrintDefaults()
 		return
 	}
 
-	if *baseURL == "" {
-		log.Fatal("start URL cannot be empty")
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if err := flagConflict(check, set); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\nUsage of %s [check] [seed urls...]:\n", err, os.Args[0])
+		flag.CommandLine.SetOutput(os.Stderr)
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	seeds, err := readSeeds(*seedsFile, flag.Args())
+	if err != nil {
+		log.Fatalf("failed to read seeds: %v\n", err)
+	}
+
+	// url defaults to the home page only when no other seeds are given
+	if set["url"] || len(seeds) < 1 {
+		if *baseURL == "" {
+			log.Fatal("start URL cannot be empty")
+		}
+
+		seeds = append([]string{*baseURL}, seeds...)
 	}
 
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	defer cancelFunc()
 
-	resp, err := scrape.StartWithDepthAndDomainRegex(ctx, *baseURL, *maxDepth, *domainRegex)
+	// interrupt pauses the crawl so that the state is saved before exiting
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		cancelFunc()
+	}()
+
+	opts := []scrape.Option{
+		scrape.WithMaxDepth(*maxDepth),
+		scrape.WithDomainRegex(*domainRegex),
+		scrape.WithWorkers(*workers),
+		scrape.WithTimeout(*timeout),
+		scrape.WithUserAgent(*userAgent),
+		scrape.WithIgnoreRobots(*ignoreRobots),
+		scrape.WithRateLimit(*rate),
+		scrape.WithPerHostConcurrency(*perHostConcurrency),
+		scrape.WithFollowNofollow(*followNofollow),
+		scrape.WithMaxRedirects(*maxRedirects),
+		scrape.WithURLRules(urlRules...),
+		scrape.WithSitemapSeeds(*sitemapSeeds),
+		scrape.WithLimits(scrape.Limits{
+			MaxPages:          *maxPages,
+			MaxPagesPerHost:   *maxPagesPerHost,
+			MaxURLLength:      *maxURLLength,
+			MaxSegmentRepeats: *maxSegmentRepeats,
+			MaxQueryVariants:  *maxQueryVariants,
+			MaxDuration:       *maxDuration,
+		}),
+	}
+
+	normalizer := &scrape.URLNormalizer{SortQuery: true, FoldTrailingSlash: *foldTrailingSlash}
+	for _, p := range strings.Split(*stripParams, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			normalizer.StripParams = append(normalizer.StripParams, p)
+		}
+	}
+	opts = append(opts, scrape.WithNormalizer(normalizer))
+
+	switch *strategy {
+	case "short-paths":
+		opts = append(opts, scrape.WithPriority(scrape.ShortPaths))
+	case "inlinks":
+		opts = append(opts, scrape.WithPriority(scrape.MostInlinks))
+	default:
+		opts = append(opts, scrape.WithStrategy(scrape.Strategy(*strategy)))
+	}
+
+	if *resume != "" {
+		opts = append(opts, scrape.WithStateStore(scrape.FileStore(*resume), *checkpointInterval))
+	}
+
+	retry := scrape.DefaultRetryPolicy
+	retry.MaxAttempts = *maxAttempts
+	opts = append(opts, scrape.WithRetryPolicy(retry))
+
+	if *follow != "" {
+		var kinds []scrape.LinkKind
+		for _, k := range strings.Split(*follow, ",") {
+			kinds = append(kinds, scrape.LinkKind(strings.TrimSpace(k)))
+		}
+
+		opts = append(opts, scrape.WithFollow(kinds...))
+	}
+
+	if *maxWorkers > 0 {
+		opts = append(opts, scrape.WithAutoScale(*minWorkers, *maxWorkers))
+	}
+
+	if *rulesFile != "" {
+		rules, err := scrape.LoadRules(*rulesFile)
+		if err != nil {
+			log.Fatalf("failed to load rules: %v\n", err)
+		}
+
+		opts = append(opts, scrape.WithRules(rules...))
+	}
+
+	sitemap := &scrape.SitemapWriter{
+		File:           *sitemapFile,
+		BaseURL:        *sitemapBaseURL,
+		CanonicalOnly:  *sitemapCanonical,
+		ExcludeNoindex: *sitemapNoindex,
+		Priority:       scrape.SitemapPriority(*sitemapPriority),
+		ChangeFreqs:    changeFreqs,
+	}
+	switch {
+	case check:
+		opts = append(opts, scrape.WithLinkCheck(true))
+	case *rulesFile != "":
+		opts = append(opts, scrape.WithHooks(streamRecords(os.Stdout)))
+		if *sitemapFile != "" {
+			opts = append(opts, scrape.WithSinks(sitemap))
+		}
+	case *sitemapFile != "":
+		opts = append(opts, scrape.WithSinks(sitemap))
+	default:
+		opts = append(opts, scrape.WithSinks(scrape.WriterSink(os.Stdout)))
+	}
+
+	resp, err := scrape.New(opts...).Run(ctx, seeds...)
 	if err != nil {
 		log.Fatalf("couldn't start scrape: %v\n", err)
 	}
 
-	if *sitemapFile != "" {
-		scrape.Sitemap(resp, *sitemapFile)
-		return
+	if check && printBrokenLinks(resp) > 0 {
+		os.Exit(1)
 	}
-
-	fmt.Print(resp)
 }
@@ -0,0 +1,515 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime"
+	"time"
+)
+
+// Crawler holds the configuration of a crawl and starts the scrapping with it
+type Crawler struct {
+	maxDepth           int                   // maxDepth of crawl, -1 means no limit for maxDepth
+	domainRegex        string                // domainRegex restricts crawling to matching domains. Defaults to seed domain
+	workers            int                   // workers is the number of minions crawling the urls
+	minWorkers         int                   // minWorkers the pool can shrink to when auto scaling
+	maxWorkers         int                   // maxWorkers the pool can grow to when auto scaling. 0 disables auto scaling
+	client             *http.Client          // client used by the minions to fetch the urls. Defaults to client with timeouts
+	transport          http.RoundTripper     // transport overrides the client's transport if set
+	timeout            time.Duration         // timeout overrides the client's timeout if set
+	sinks              []Sink                // sinks receive the response once the crawl is done
+	userAgent          string                // userAgent sent with requests and used to evaluate robots.txt
+	rateLimit          float64               // rateLimit of requests per second to a single host. 0 means no limit
+	perHostConcurrency int                   // perHostConcurrency caps the in flight requests to a single host. 0 means no limit
+	hostLimits         []HostLimit           // hostLimits override the default limits for matching hosts
+	ignoreRobots       bool                  // ignoreRobots crawls urls disallowed by robots.txt
+	retry              RetryPolicy           // retry policy for the transient fetch failures
+	checkLinks         bool                  // checkLinks checks the urls failing domainRegex without crawling them
+	extract            []LinkKind            // extract holds the kinds of links extracted. nil extracts all
+	follow             []LinkKind            // follow holds the kinds of links followed. nil follows the default kinds
+	followNofollow     bool                  // followNofollow follows the links marked nofollow
+	maxRedirects       int                   // maxRedirects is the max redirect hops followed for a single url
+	store              StateStore            // store the crawl state is saved to and resumed from. nil means state is not saved
+	checkpoint         time.Duration         // checkpoint is the interval the state is saved at
+	hooks              Hooks                 // hooks called while the crawl is running
+	before             map[Stage][]Processor // before holds the processors run before the built-in stages
+	after              map[Stage][]Processor // after holds the processors run after the built-in stages
+	processors         []Processor           // processors run after all the built-in stages
+	rules              []*RuleSet            // rules extracting the records from the pages
+	urlRules           []*URLRule            // urlRules include or exclude the urls followed and recorded
+	limits             Limits                // limits guarding the crawl against crawl traps
+	strategy           Strategy              // strategy the queued urls are crawled in the order of
+	sitemapSeeds       bool                  // sitemapSeeds seeds the crawl with the urls in the sitemaps of the seed hosts
+	score              ScoreFunc             // score orders the urls for the priority strategy
+	maxBodySize        int64                 // maxBodySize is the max bytes of the page body read
+	discardBodies      bool                  // discardBodies drops the page bodies once the links are extracted
+	normalizer         Normalizer            // normalizer applied to the urls before they are deduped. nil leaves them as is
+}
+
+// Option configures the Crawler
+type Option func(c *Crawler)
+
+// WithMaxDepth sets the max depth of the crawl. -1 means no limit
+func WithMaxDepth(maxDepth int) Option {
+	return func(c *Crawler) {
+		c.maxDepth = maxDepth
+	}
+}
+
+// WithDomainRegex restricts the crawl to the domains matching the regex
+func WithDomainRegex(regex string) Option {
+	return func(c *Crawler) {
+		c.domainRegex = regex
+	}
+}
+
+// WithWorkers sets the number of minions crawling the urls
+func WithWorkers(workers int) Option {
+	return func(c *Crawler) {
+		c.workers = workers
+	}
+}
+
+// WithAutoScale lets the minion pool grow and shrink between min and max workers
+// based on the queue length and observed latency
+func WithAutoScale(min, max int) Option {
+	return func(c *Crawler) {
+		c.minWorkers = min
+		c.maxWorkers = max
+	}
+}
+
+// WithHTTPClient sets the http client the minions use to fetch the urls
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Crawler) {
+		c.client = client
+	}
+}
+
+// WithTransport sets the transport used to fetch the urls, such as a proxy or recording transport
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Crawler) {
+		c.transport = transport
+	}
+}
+
+// WithTimeout sets the timeout for fetching a single url
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Crawler) {
+		c.timeout = timeout
+	}
+}
+
+// WithUserAgent sets the user agent sent with the requests and used to evaluate robots.txt
+func WithUserAgent(userAgent string) Option {
+	return func(c *Crawler) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithIgnoreRobots crawls the urls regardless of robots.txt rules and crawl delay
+func WithIgnoreRobots(ignore bool) Option {
+	return func(c *Crawler) {
+		c.ignoreRobots = ignore
+	}
+}
+
+// WithRateLimit limits the requests per second made to a single host
+func WithRateLimit(rate float64) Option {
+	return func(c *Crawler) {
+		c.rateLimit = rate
+	}
+}
+
+// WithPerHostConcurrency caps the number of in flight requests to a single host
+func WithPerHostConcurrency(n int) Option {
+	return func(c *Crawler) {
+		c.perHostConcurrency = n
+	}
+}
+
+// WithHostLimits overrides the rate limit and concurrency for hosts matching the limit patterns.
+// Limits are matched in order and the first match applies
+func WithHostLimits(limits ...HostLimit) Option {
+	return func(c *Crawler) {
+		c.hostLimits = append(c.hostLimits, limits...)
+	}
+}
+
+// WithRetryPolicy sets the policy to retry transient fetch failures such as timeouts, 429 and 5xx.
+// MaxAttempts of 1 disables retries
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Crawler) {
+		c.retry = policy
+	}
+}
+
+// WithLinkCheck checks the urls failing the domain regex, and the urls found at max depth,
+// with HEAD falling back to GET without crawling them
+func WithLinkCheck(check bool) Option {
+	return func(c *Crawler) {
+		c.checkLinks = check
+	}
+}
+
+// WithExtract sets the kinds of links extracted from the pages and recorded in the response.
+// Defaults to all the kinds. Followed kinds are always extracted
+func WithExtract(kinds ...LinkKind) Option {
+	return func(c *Crawler) {
+		c.extract = kinds
+	}
+}
+
+// WithFollow sets the kinds of links that are followed. Defaults to DefaultFollowKinds
+func WithFollow(kinds ...LinkKind) Option {
+	return func(c *Crawler) {
+		c.follow = kinds
+	}
+}
+
+// WithFollowNofollow follows the links marked rel=nofollow and links on pages with meta robots nofollow.
+// Such links are only recorded by default
+func WithFollowNofollow(follow bool) Option {
+	return func(c *Crawler) {
+		c.followNofollow = follow
+	}
+}
+
+// WithMaxRedirects sets the max redirect hops followed for a single url. Defaults to 10
+func WithMaxRedirects(n int) Option {
+	return func(c *Crawler) {
+		c.maxRedirects = n
+	}
+}
+
+// WithNormalizer sets the normalizer applied to the seed and extracted urls before they are deduped.
+// Defaults to DefaultNormalizer. nil leaves the urls as found
+func WithNormalizer(n Normalizer) Option {
+	return func(c *Crawler) {
+		c.normalizer = n
+	}
+}
+
+// WithStateStore saves the crawl state to the store every interval and when the crawl stops.
+// If the store holds a state, the crawl resumes from it and the seed passed to Run is ignored.
+// interval defaults to 30s if not positive
+func WithStateStore(store StateStore, interval time.Duration) Option {
+	return func(c *Crawler) {
+		c.store = store
+		c.checkpoint = interval
+	}
+}
+
+// WithHooks sets the hooks called with the pages, errors, skipped and checked urls while the crawl is running
+func WithHooks(hooks Hooks) Option {
+	return func(c *Crawler) {
+		c.hooks = hooks
+	}
+}
+
+// WithMaxBodySize sets the max bytes of the page body read. Links are extracted from the read bytes only. Defaults to 10MB
+func WithMaxBodySize(n int64) Option {
+	return func(c *Crawler) {
+		c.maxBodySize = n
+	}
+}
+
+// WithRetainBodies sets if the page bodies are passed on to the hooks and processors.
+// Defaults to true. Link only crawls can drop them once the links are extracted
+func WithRetainBodies(retain bool) Option {
+	return func(c *Crawler) {
+		c.discardBodies = !retain
+	}
+}
+
+// WithProcessors adds the processors run after all the built-in stages
+func WithProcessors(processors ...Processor) Option {
+	return func(c *Crawler) {
+		c.processors = append(c.processors, processors...)
+	}
+}
+
+// WithProcessorsBefore adds the processors run before the built-in stage
+func WithProcessorsBefore(stage Stage, processors ...Processor) Option {
+	return func(c *Crawler) {
+		if c.before == nil {
+			c.before = make(map[Stage][]Processor)
+		}
+
+		c.before[stage] = append(c.before[stage], processors...)
+	}
+}
+
+// WithProcessorsAfter adds the processors run after the built-in stage.
+// processors are skipped if the stage stops processing the dump, such as the max-depth stage at max depth
+func WithProcessorsAfter(stage Stage, processors ...Processor) Option {
+	return func(c *Crawler) {
+		if c.after == nil {
+			c.after = make(map[Stage][]Processor)
+		}
+
+		c.after[stage] = append(c.after[stage], processors...)
+	}
+}
+
+// WithRules sets the rule sets extracting the records from the pages matching their url patterns
+func WithRules(sets ...*RuleSet) Option {
+	return func(c *Crawler) {
+		c.rules = append(c.rules, sets...)
+	}
+}
+
+// WithURLRules adds the ordered rules including or excluding the urls followed and recorded.
+// first matching rule decides. urls matching no rule are included unless there are include rules
+func WithURLRules(rules ...*URLRule) Option {
+	return func(c *Crawler) {
+		c.urlRules = append(c.urlRules, rules...)
+	}
+}
+
+// WithLimits sets the limits guarding the crawl against crawl traps such as calendars and session ids
+func WithLimits(limits Limits) Option {
+	return func(c *Crawler) {
+		c.limits = limits
+	}
+}
+
+// WithStrategy sets the order the queued urls are crawled in. Defaults to StrategyBFS
+func WithStrategy(strategy Strategy) Option {
+	return func(c *Crawler) {
+		c.strategy = strategy
+	}
+}
+
+// WithPriority crawls the queued urls with higher score first
+func WithPriority(score ScoreFunc) Option {
+	return func(c *Crawler) {
+		c.strategy = StrategyPriority
+		c.score = score
+	}
+}
+
+// WithSitemapSeeds seeds the crawl with the urls listed in the sitemaps of the seed hosts.
+// sitemaps are found from robots.txt Sitemap directives, falling back to /sitemap.xml. sitemap indexes are followed
+func WithSitemapSeeds(seed bool) Option {
+	return func(c *Crawler) {
+		c.sitemapSeeds = seed
+	}
+}
+
+// WithSinks adds sinks that receive the response once the crawl is done
+func WithSinks(sinks ...Sink) Option {
+	return func(c *Crawler) {
+		c.sinks = append(c.sinks, sinks...)
+	}
+}
+
+// New returns a new Crawler configured with given options
+func New(opts ...Option) *Crawler {
+	c := &Crawler{
+		maxDepth:     -1,
+		workers:      runtime.NumCPU() * 2,
+		userAgent:    defaultUserAgent,
+		retry:        DefaultRetryPolicy,
+		normalizer:   DefaultNormalizer,
+		maxRedirects: defaultMaxRedirects,
+		maxBodySize:  defaultMaxBodySize,
+		strategy:     StrategyBFS,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Run crawls starting from the seed urls and returns the response. first seed is the base url of the response.
+// Response is passed on to the sinks before returning
+func (c *Crawler) Run(ctx context.Context, seeds ...string) (resp *Response, err error) {
+	if c.workers < 1 {
+		return nil, fmt.Errorf("invalid number of workers: %d", c.workers)
+	}
+
+	if c.maxWorkers > 0 && (c.minWorkers < 1 || c.maxWorkers < c.minWorkers) {
+		return nil, fmt.Errorf("invalid auto scale workers: min %d max %d", c.minWorkers, c.maxWorkers)
+	}
+
+	var state *CrawlState
+	if c.store != nil {
+		state, err = c.store.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load crawl state: %v", err)
+		}
+
+		if state != nil && state.Completed {
+			log.Printf("crawl of %s saved at %v is complete. starting a new crawl\n", state.BaseURL, state.SavedAt)
+			state = nil
+		}
+
+		if state != nil {
+			log.Printf("resuming crawl of %s saved at %v\n", state.BaseURL, state.SavedAt)
+			seeds = state.Seeds
+			if len(seeds) < 1 {
+				seeds = []string{state.BaseURL}
+			}
+		}
+	}
+
+	seedURLs, err := parseSeeds(c.normalizer, seeds)
+	if err != nil {
+		return nil, err
+	}
+
+	g := newGru(seedURLs[0], c.maxDepth)
+	g.seeds = seedURLs
+	switch {
+	case c.domainRegex != "":
+		err = setDomainRegex(g, c.domainRegex)
+	case len(seedURLs) > 1:
+		err = setDomainRegex(g, seedsDomainRegex(seedURLs))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rs := range c.rules {
+		err = compileRuleSet(rs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, r := range c.urlRules {
+		err = compileURLRule(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = validStrategy(c.strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.strategy == StrategyPriority && c.score == nil {
+		return nil, fmt.Errorf("priority strategy requires a score func")
+	}
+
+	g.unScrapped = newFrontier(c.strategy, func(u *url.URL, depth int) float64 {
+		return c.score(&Crawl{g: g}, u, depth)
+	})
+
+	g.urlRules = c.urlRules
+	g.limits = c.limits
+	if c.limits.MaxDuration > 0 {
+		g.deadline = time.Now().Add(c.limits.MaxDuration)
+	}
+
+	g.processors, err = pipeline(c.before, c.after, c.processors)
+	if err != nil {
+		return nil, err
+	}
+
+	g.checkLinks = c.checkLinks
+	g.hooks = c.hooks
+	if c.store != nil {
+		g.store = c.store
+		g.checkpoint = c.checkpoint
+		if g.checkpoint <= 0 {
+			g.checkpoint = defaultCheckpointInterval
+		}
+
+		if state != nil {
+			restoreState(g, state)
+		}
+	}
+	g.normalizer = c.normalizer
+	if c.retry.MaxAttempts > 1 {
+		retry := c.retry
+		g.retry = &retry
+	}
+
+	if c.rateLimit > 0 || c.perHostConcurrency > 0 || len(c.hostLimits) > 0 {
+		def := HostLimit{Rate: c.rateLimit, MaxInFlight: c.perHostConcurrency}
+		g.limiter, err = newHostLimiter(def, c.hostLimits)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cfg := newCrawlConfig(httpClient(c))
+	if !c.ignoreRobots {
+		cfg.robots = newRobotsCache(cfg.client, c.userAgent)
+	}
+
+	cfg.followNofollow = c.followNofollow
+	cfg.normalizer = c.normalizer
+	cfg.domainRegex = g.domainRegex
+	cfg.maxRedirects = c.maxRedirects
+	cfg.maxBodySize = c.maxBodySize
+	cfg.discardBody = c.discardBodies
+	cfg.rules = c.rules
+	cfg.urlRules = c.urlRules
+	if c.extract != nil {
+		cfg.extract = kindsToSet(c.extract)
+	}
+
+	if c.follow != nil {
+		cfg.follow = kindsToSet(c.follow)
+		if cfg.extract != nil {
+			for k := range cfg.follow {
+				cfg.extract[k] = true
+			}
+		}
+	}
+
+	if c.sitemapSeeds && state == nil {
+		seedSitemaps(g, cfg, c.userAgent)
+	}
+
+	spawn := func(name string) *minion {
+		m := newMinion(name, cfg, g.payloadCh, g.submitDumpCh)
+		go startMinion(ctx, m)
+		return m
+	}
+
+	workers := c.workers
+	if c.maxWorkers > 0 {
+		g.pool = newMinionPool(c.minWorkers, c.maxWorkers, spawn)
+		if workers < c.minWorkers {
+			workers = c.minWorkers
+		}
+
+		if workers > c.maxWorkers {
+			workers = c.maxWorkers
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		g.minions = append(g.minions, spawn(minionName(i)))
+	}
+
+	if g.pool != nil {
+		g.pool.spawned = workers
+	}
+
+	startGru(ctx, g)
+	resp = gruToResponse(g)
+	for _, s := range c.sinks {
+		err = s.Write(resp)
+		if err != nil {
+			log.Printf("failed to write response to sink: %v\n", err)
+			return resp, err
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,102 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testServer() *httptest.Server {
+	pages := map[string]string{
+		"/":  `<a href="/1">1</a><a href="/2">2</a><a href="http://github.com">github</a>`,
+		"/1": `<a href="/">home</a><a href="/3">3</a>`,
+		"/2": `<a href="/1">1</a>`,
+		"/3": `<a href="/">home</a>`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, page)
+	}))
+}
+
+func TestCrawler_Run(t *testing.T) {
+	ts := testServer()
+	defer ts.Close()
+
+	tests := []struct {
+		opts   []Option
+		unique int
+		err    bool
+	}{
+		{
+			unique: 4,
+		},
+
+		{
+			opts:   []Option{WithMaxDepth(1), WithWorkers(1)},
+			unique: 3,
+		},
+
+		{
+			opts:   []Option{WithAutoScale(1, 4), WithWorkers(1)},
+			unique: 4,
+		},
+
+		{
+			opts: []Option{WithAutoScale(4, 1)},
+			err:  true,
+		},
+
+		{
+			opts: []Option{WithWorkers(0)},
+			err:  true,
+		},
+
+		{
+			opts: []Option{WithDomainRegex("[")},
+			err:  true,
+		},
+	}
+
+	for _, c := range tests {
+		var sinkResp *Response
+		opts := append(c.opts, WithSinks(SinkFunc(func(resp *Response) error {
+			sinkResp = resp
+			return nil
+		})))
+
+		resp, err := New(opts...).Run(context.Background(), ts.URL+"/")
+		if err != nil {
+			if !c.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			continue
+		}
+
+		if c.err {
+			t.Fatal("expected error but got none")
+		}
+
+		if len(resp.UniqueURLs) != c.unique {
+			t.Fatalf("expected %d unique urls but got %d: %v", c.unique, len(resp.UniqueURLs), resp.UniqueURLs)
+		}
+
+		if sinkResp != resp {
+			t.Fatal("expected response to be written to sink")
+		}
+
+		if r := resp.Referrers("http://github.com/"); len(r) != 1 || r[0].Source != ts.URL+"/" || r[0].Text != "github" {
+			t.Fatalf("expected github to be referred by the home page but got %v", r)
+		}
+	}
+}
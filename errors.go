@@ -0,0 +1,63 @@
+package scrape
+
+import "fmt"
+
+// HTTPStatusError is returned when the url responds with a status code other than 200
+type HTTPStatusError struct {
+	URL  string // URL that is crawled
+	Code int    // Code is the http status code of the response
+}
+
+// Error returns the error message
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s responded with code %d", e.URL, e.Code)
+}
+
+// ContentTypeError is returned when the url responds with a content type that cannot be crawled
+type ContentTypeError struct {
+	URL         string // URL that is crawled
+	ContentType string // ContentType of the response
+}
+
+// Error returns the error message
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("%s responded with unknown content type: %s", e.URL, e.ContentType)
+}
+
+// FetchError is returned when the url couldn't be fetched, such as dns, connection or timeout errors
+type FetchError struct {
+	URL string // URL that is crawled
+	Err error  // Err is the underlying error returned by the http client
+}
+
+// Error returns the error message
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("failed to fetch %s: %v", e.URL, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// RedirectLoopError is returned when the url redirects back to an url already in its redirect chain
+type RedirectLoopError struct {
+	URL       string     // URL that is crawled
+	Redirects []Redirect // Redirects followed until the loop is detected
+}
+
+// Error returns the error message
+func (e *RedirectLoopError) Error() string {
+	return fmt.Sprintf("%s redirect loop after %d redirects at %s", e.URL, len(e.Redirects), e.Redirects[len(e.Redirects)-1].To)
+}
+
+// TooManyRedirectsError is returned when the url redirects more than the max redirects allowed
+type TooManyRedirectsError struct {
+	URL       string     // URL that is crawled
+	Redirects []Redirect // Redirects followed until the limit is hit
+}
+
+// Error returns the error message
+func (e *TooManyRedirectsError) Error() string {
+	return fmt.Sprintf("%s stopped after %d redirects", e.URL, len(e.Redirects))
+}
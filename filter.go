@@ -0,0 +1,155 @@
+package scrape
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// URLPart is the part of the url a rule is matched against
+type URLPart string
+
+// Parts of the url the rules match
+const (
+	MatchURL   URLPart = "url"   // full url
+	MatchPath  URLPart = "path"  // path of the url
+	MatchQuery URLPart = "query" // raw query of the url
+)
+
+// URLRule includes or excludes the urls matching the pattern.
+// Rules are matched in order and the first matching rule decides. urls matching no rule are
+// included unless there are include rules
+type URLRule struct {
+	Exclude bool    // Exclude the matching urls. matching urls are included otherwise
+	Part    URLPart // Part of the url matched. Defaults to the full url
+	Pattern string  // Pattern is a regex, or a glob if Glob is set
+	Glob    bool    // Glob pattern where * matches within a path segment and ** across them
+
+	re *regexp.Regexp // compiled pattern
+}
+
+// Include returns a rule including the urls matching the spec.
+// spec is [url:|path:|query:][glob:]pattern, such as path:glob:/docs/**
+func Include(spec string) (*URLRule, error) {
+	return parseURLRule(spec, false)
+}
+
+// Exclude returns a rule excluding the urls matching the spec.
+// spec is [url:|path:|query:][glob:]pattern, such as query:(^|&)sort=
+func Exclude(spec string) (*URLRule, error) {
+	return parseURLRule(spec, true)
+}
+
+// parseURLRule parses and compiles the rule from the spec
+func parseURLRule(spec string, exclude bool) (*URLRule, error) {
+	r := &URLRule{Exclude: exclude, Part: MatchURL}
+	for _, p := range []URLPart{MatchURL, MatchPath, MatchQuery} {
+		if strings.HasPrefix(spec, string(p)+":") {
+			r.Part, spec = p, strings.TrimPrefix(spec, string(p)+":")
+			break
+		}
+	}
+
+	if strings.HasPrefix(spec, "glob:") {
+		r.Glob, spec = true, strings.TrimPrefix(spec, "glob:")
+	}
+
+	r.Pattern = spec
+	return r, compileURLRule(r)
+}
+
+// String returns the rule in the spec form along with the action
+func (r *URLRule) String() string {
+	action := "include"
+	if r.Exclude {
+		action = "exclude"
+	}
+
+	part := r.Part
+	if part == "" {
+		part = MatchURL
+	}
+
+	glob := ""
+	if r.Glob {
+		glob = "glob:"
+	}
+
+	return fmt.Sprintf("%s %s:%s%s", action, part, glob, r.Pattern)
+}
+
+// globToRegex converts the glob to an anchored regex
+func globToRegex(glob string) string {
+	re := regexp.QuoteMeta(glob)
+	re = strings.Replace(re, `\*\*`, `.*`, -1)
+	re = strings.Replace(re, `\*`, `[^/]*`, -1)
+	re = strings.Replace(re, `\?`, `[^/]`, -1)
+	return "^" + re + "$"
+}
+
+// compileURLRule compiles the pattern of the rule
+func compileURLRule(r *URLRule) (err error) {
+	if r.re != nil {
+		return nil
+	}
+
+	switch r.Part {
+	case "":
+		r.Part = MatchURL
+	case MatchURL, MatchPath, MatchQuery:
+	default:
+		return fmt.Errorf("unknown url part %s", r.Part)
+	}
+
+	if r.Pattern == "" {
+		return fmt.Errorf("empty url rule pattern")
+	}
+
+	pattern := r.Pattern
+	if r.Glob {
+		pattern = globToRegex(pattern)
+	}
+
+	r.re, err = regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid url rule %s: %v", r.Pattern, err)
+	}
+
+	return nil
+}
+
+// matchURLRule says if the rule matches the url
+func matchURLRule(r *URLRule, u *url.URL) bool {
+	switch r.Part {
+	case MatchPath:
+		return r.re.MatchString(u.EscapedPath())
+	case MatchQuery:
+		return r.re.MatchString(u.RawQuery)
+	}
+
+	return r.re.MatchString(u.String())
+}
+
+// filterURL says if the url is allowed by the rules along with the rule that decided. nil rule if none matched
+func filterURL(rules []*URLRule, u *url.URL) (allowed bool, rule *URLRule) {
+	hasInclude := false
+	for _, r := range rules {
+		if matchURLRule(r, u) {
+			return !r.Exclude, r
+		}
+
+		hasInclude = hasInclude || !r.Exclude
+	}
+
+	return !hasInclude, nil
+}
+
+// filterReason returns the reason the url is filtered
+func filterReason(rule *URLRule) string {
+	if rule == nil {
+		return "no include rule matched"
+	}
+
+	return rule.String()
+}
@@ -0,0 +1,110 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func Test_filterURL(t *testing.T) {
+	mustRule := func(r *URLRule, err error) *URLRule {
+		if err != nil {
+			t.Fatalf("failed to parse rule: %v", err)
+		}
+
+		return r
+	}
+
+	rules := []*URLRule{
+		mustRule(Exclude("path:/logout")),
+		mustRule(Exclude("query:(^|&)sort=")),
+		mustRule(Exclude("path:glob:/docs/*/draft")),
+		mustRule(Include("path:glob:/docs/**")),
+		mustRule(Include(`^https://test\.com/$`)),
+	}
+
+	tests := []struct {
+		url     string
+		allowed bool
+		rule    string
+	}{
+		{url: "https://test.com/", allowed: true, rule: `include url:^https://test\.com/$`},
+		{url: "https://test.com/docs/a/b", allowed: true, rule: "include path:glob:/docs/**"},
+		{url: "https://test.com/docs/a/draft", rule: "exclude path:glob:/docs/*/draft"},
+		{url: "https://test.com/docs/a/b/draft", allowed: true, rule: "include path:glob:/docs/**"},
+		{url: "https://test.com/docs/a?page=2&sort=asc", rule: "exclude query:(^|&)sort="},
+		{url: "https://test.com/docs/logout", rule: "exclude path:/logout"},
+		{url: "https://test.com/logout", rule: "exclude path:/logout"},
+		{url: "https://test.com/blog"},
+	}
+
+	for _, c := range tests {
+		u, _ := url.Parse(c.url)
+		allowed, rule := filterURL(rules, u)
+		if allowed != c.allowed {
+			t.Fatalf("expected %s allowed(%t) but got %t", c.url, c.allowed, allowed)
+		}
+
+		if (rule == nil && c.rule != "") || (rule != nil && rule.String() != c.rule) {
+			t.Fatalf("expected %s to be decided by %q but got %v", c.url, c.rule, rule)
+		}
+	}
+
+	// urls matching no rule are allowed without include rules
+	u, _ := url.Parse("https://test.com/blog")
+	if allowed, _ := filterURL(rules[:3], u); !allowed {
+		t.Fatal("expected url to be allowed without include rules")
+	}
+
+	for _, spec := range []string{"", "path:", "path:[", "glob:"} {
+		if _, err := Include(spec); err == nil {
+			t.Fatalf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestCrawler_RunURLRules(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/docs/">docs</a><a href="/blog">blog</a>`)
+		case "/docs/":
+			fmt.Fprint(w, `<a href="/docs/1">1</a><a href="/docs/1?sort=asc">sorted</a><a href="/logout">logout</a>`)
+		default:
+			fmt.Fprint(w, `<a href="/">home</a>`)
+		}
+	}))
+	defer ts.Close()
+
+	inc, _ := Include("path:glob:/docs/**")
+	exc, _ := Exclude("query:sort=")
+	home, _ := Include("path:^/$")
+	resp, err := New(WithIgnoreRobots(true), WithURLRules(exc, inc, home)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(resp.UniqueURLs) != 3 {
+		t.Fatalf("expected /, /docs/ and /docs/1 to be crawled but got %v", resp.UniqueURLs)
+	}
+
+	expected := map[string]string{
+		ts.URL + "/blog":            "no include rule matched",
+		ts.URL + "/docs/1?sort=asc": "exclude query:sort=",
+		ts.URL + "/logout":          "no include rule matched",
+	}
+
+	for u, rule := range expected {
+		if resp.FilteredURLs[u] != rule {
+			t.Fatalf("expected %s to be filtered by %q but got %v", u, rule, resp.FilteredURLs)
+		}
+
+		if len(resp.Referrers(u)) != 0 {
+			t.Fatalf("expected filtered url %s not to be recorded", u)
+		}
+	}
+}
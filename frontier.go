@@ -0,0 +1,254 @@
+package scrape
+
+import (
+	"container/heap"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Strategy is the order the queued urls are crawled in
+type Strategy string
+
+// Strategies to order the crawl by
+const (
+	StrategyBFS      Strategy = "bfs"      // shallower urls first, in the order they are found
+	StrategyDFS      Strategy = "dfs"      // deeper urls first, latest found first
+	StrategyPriority Strategy = "priority" // urls with higher score first, in the order they are found on ties
+)
+
+// ScoreFunc scores the url found at depth for StrategyPriority. urls with higher score are crawled first.
+// urls are scored when queued and scored again whenever they are found again while still queued
+type ScoreFunc func(c *Crawl, u *url.URL, depth int) float64
+
+// ShortPaths scores the urls with fewer path segments higher
+func ShortPaths(c *Crawl, u *url.URL, depth int) float64 {
+	path := strings.Trim(u.Path, "/")
+	if path == "" {
+		return 0
+	}
+
+	return -float64(strings.Count(path, "/") + 1)
+}
+
+// MostInlinks scores the urls linked from more pages higher
+func MostInlinks(c *Crawl, u *url.URL, depth int) float64 {
+	return float64(c.Inlinks(u.String()))
+}
+
+// frontierItem is a queued url
+type frontierItem struct {
+	depth  int      // depth the url is found at
+	u      *url.URL // u is the queued url
+	source string   // source is the page the url is found on. empty for the seeds
+	seq    int      // seq is the order the url is queued in
+	score  float64  // score of the url for the priority strategy
+	index  int      // index of the item in the heap of its host
+}
+
+// hostQueue is the heap of the queued urls of a single host
+type hostQueue struct {
+	strategy Strategy
+	items    []*frontierItem
+}
+
+// frontier holds the urls yet to be crawled in the order of the strategy.
+// urls are queued per host so that the urls of a host that can't be crawled now are skipped together
+type frontier struct {
+	strategy Strategy
+	score    func(u *url.URL, depth int) float64 // score scores the urls for the priority strategy
+	hosts    map[string]*hostQueue               // hosts holds the queued urls per host
+	queued   map[string]*frontierItem            // queued holds the items by their url
+	seq      int                                 // seq of the last queued url
+}
+
+// validStrategy returns an error if the strategy is unknown
+func validStrategy(s Strategy) error {
+	switch s {
+	case StrategyBFS, StrategyDFS, StrategyPriority:
+		return nil
+	}
+
+	return fmt.Errorf("unknown crawl strategy %s", s)
+}
+
+// newFrontier returns an empty frontier ordered by the strategy. score is only used by the priority strategy
+func newFrontier(strategy Strategy, score func(u *url.URL, depth int) float64) *frontier {
+	return &frontier{
+		strategy: strategy,
+		score:    score,
+		hosts:    make(map[string]*hostQueue),
+		queued:   make(map[string]*frontierItem),
+	}
+}
+
+// Len returns the number of queued urls
+func (f *frontier) Len() int {
+	return len(f.queued)
+}
+
+// before says if the url a is crawled before b as per the strategy falling back to the order they are queued in
+func before(strategy Strategy, a, b *frontierItem) bool {
+	switch strategy {
+	case StrategyDFS:
+		if a.depth != b.depth {
+			return a.depth > b.depth
+		}
+
+		return a.seq > b.seq
+	case StrategyPriority:
+		if a.score != b.score {
+			return a.score > b.score
+		}
+	default:
+		if a.depth != b.depth {
+			return a.depth < b.depth
+		}
+	}
+
+	return a.seq < b.seq
+}
+
+// Len returns the number of queued urls of the host
+func (q *hostQueue) Len() int {
+	return len(q.items)
+}
+
+// Less orders the urls as per the strategy
+func (q *hostQueue) Less(i, j int) bool {
+	return before(q.strategy, q.items[i], q.items[j])
+}
+
+// Swap swaps the urls in the heap
+func (q *hostQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.items[i].index = i
+	q.items[j].index = j
+}
+
+// Push adds the item to the heap
+func (q *hostQueue) Push(x interface{}) {
+	it := x.(*frontierItem)
+	it.index = len(q.items)
+	q.items = append(q.items, it)
+}
+
+// Pop removes the last item from the heap
+func (q *hostQueue) Pop() interface{} {
+	n := len(q.items) - 1
+	it := q.items[n]
+	q.items[n] = nil
+	q.items = q.items[:n]
+	return it
+}
+
+// scoreItem scores the item if the frontier is ordered by priority
+func scoreItem(f *frontier, it *frontierItem) {
+	if f.strategy == StrategyPriority && f.score != nil {
+		it.score = f.score(it.u, it.depth)
+	}
+}
+
+// pushURLs queues the urls found at depth on the source page. urls already queued are moved to the
+// shallower of the depths along with the source and scored again instead of being queued twice
+func pushURLs(f *frontier, depth int, source string, urls ...*url.URL) {
+	for _, u := range urls {
+		if it, ok := f.queued[u.String()]; ok {
+			if depth < it.depth {
+				it.depth, it.source = depth, source
+			}
+
+			scoreItem(f, it)
+			heap.Fix(f.hosts[u.Host], it.index)
+			continue
+		}
+
+		f.seq++
+		it := &frontierItem{depth: depth, u: u, source: source, seq: f.seq}
+		scoreItem(f, it)
+		f.queued[u.String()] = it
+		q, ok := f.hosts[u.Host]
+		if !ok {
+			q = &hostQueue{strategy: f.strategy}
+			f.hosts[u.Host] = q
+		}
+
+		heap.Push(q, it)
+	}
+}
+
+// popURL removes the first url in the order of the strategy whose host allow accepts, along with its depth and source.
+// only the first url of every host is looked at. nil if allow accepts none of the hosts
+func popURL(f *frontier, allow func(host string) bool) (depth int, u *url.URL, source string) {
+	heads := make([]*frontierItem, 0, len(f.hosts))
+	for _, q := range f.hosts {
+		heads = append(heads, q.items[0])
+	}
+
+	sort.Slice(heads, func(i, j int) bool {
+		return before(f.strategy, heads[i], heads[j])
+	})
+
+	for _, it := range heads {
+		if allow != nil && !allow(it.u.Host) {
+			continue
+		}
+
+		q := f.hosts[it.u.Host]
+		heap.Pop(q)
+		if q.Len() == 0 {
+			delete(f.hosts, it.u.Host)
+		}
+
+		delete(f.queued, it.u.String())
+		return it.depth, it.u, it.source
+	}
+
+	return 0, nil, ""
+}
+
+// queuedItems returns the queued items in the order they are queued in
+func queuedItems(f *frontier) []*frontierItem {
+	items := make([]*frontierItem, 0, len(f.queued))
+	for _, it := range f.queued {
+		items = append(items, it)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].seq < items[j].seq
+	})
+
+	return items
+}
+
+// frontierURLs returns the queued urls per depth in the order they are queued in
+func frontierURLs(f *frontier) map[int][]*url.URL {
+	m := make(map[int][]*url.URL)
+	for _, it := range queuedItems(f) {
+		m[it.depth] = append(m[it.depth], it.u)
+	}
+
+	return m
+}
+
+// pushURLsPerDepth queues the urls per depth, shallower depths first
+func pushURLsPerDepth(f *frontier, urls map[int][]*url.URL) {
+	var depths []int
+	for d := range urls {
+		depths = append(depths, d)
+	}
+
+	sort.Ints(depths)
+	for _, d := range depths {
+		pushURLs(f, d, "", urls[d]...)
+	}
+}
+
+// clearFrontier removes all the queued urls and returns them in the order they are queued in
+func clearFrontier(f *frontier) []*frontierItem {
+	items := queuedItems(f)
+	f.hosts = make(map[string]*hostQueue)
+	f.queued = make(map[string]*frontierItem)
+	return items
+}
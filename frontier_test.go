@@ -0,0 +1,162 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func Test_popURL(t *testing.T) {
+	queue := func(f *frontier) {
+		d1, _ := urlStrToURLs([]string{"http://test.com/a", "http://test.com/b/c/d"})
+		d2, _ := urlStrToURLs([]string{"http://test.com/a/b", "http://test.com/c"})
+		pushURLs(f, 1, "http://test.com/", d1...)
+		pushURLs(f, 2, "http://test.com/a", d2...)
+		d0, _ := urlStrToURLs([]string{"http://test.com/"})
+		pushURLs(f, 0, "", d0...)
+
+		// found again at a shallower depth
+		pushURLs(f, 1, "http://test.com/", d2[1])
+	}
+
+	pathScore := func(u *url.URL, depth int) float64 {
+		return ShortPaths(nil, u, depth)
+	}
+
+	tests := []struct {
+		strategy Strategy
+		score    func(u *url.URL, depth int) float64
+		expected []string
+	}{
+		{
+			strategy: StrategyBFS,
+			expected: []string{"/", "/a", "/b/c/d", "/c", "/a/b"},
+		},
+
+		{
+			strategy: StrategyDFS,
+			expected: []string{"/a/b", "/c", "/b/c/d", "/a", "/"},
+		},
+
+		{
+			strategy: StrategyPriority,
+			score:    pathScore,
+			expected: []string{"/", "/a", "/c", "/a/b", "/b/c/d"},
+		},
+	}
+
+	for _, c := range tests {
+		f := newFrontier(c.strategy, c.score)
+		queue(f)
+		if f.Len() != 5 {
+			t.Fatalf("expected 5 queued urls but got %d", f.Len())
+		}
+
+		var got []string
+		for {
+			_, u, _ := popURL(f, nil)
+			if u == nil {
+				break
+			}
+
+			got = append(got, u.Path)
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(c.expected) {
+			t.Fatalf("%s: expected %v but got %v", c.strategy, c.expected, got)
+		}
+	}
+
+	// urls of the hosts not allowed stay queued in their order and the hosts are asked only once
+	f := newFrontier(StrategyBFS, nil)
+	queue(f)
+	other, _ := url.Parse("http://other.com/x")
+	pushURLs(f, 2, "http://test.com/c", other)
+	asked := 0
+	d, u, src := popURL(f, func(host string) bool {
+		asked++
+		return host != "test.com"
+	})
+	if d != 2 || u != other || src != "http://test.com/c" || f.Len() != 5 || asked != 2 {
+		t.Fatalf("expected %v at depth 2 from http://test.com/c but got %v at %d from %s after asking %d hosts", other, u, d, src, asked)
+	}
+
+	// source moves along with the shallower depth
+	if it := f.queued["http://test.com/c"]; it.depth != 1 || it.source != "http://test.com/" {
+		t.Fatalf("expected /c at depth 1 from http://test.com/ but got %d from %s", it.depth, it.source)
+	}
+
+	if _, u, _ = popURL(f, nil); u.Path != "/" {
+		t.Fatalf("expected / but got %v", u)
+	}
+}
+
+func TestCrawler_RunStrategy(t *testing.T) {
+	// home links to the deepest page first and every page links back to the section
+	var mu sync.Mutex
+	var crawled []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		crawled = append(crawled, r.URL.Path)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/a/b/c">c</a><a href="/a/b">b</a><a href="/a">a</a>`)
+		default:
+			fmt.Fprint(w, `<a href="/a">a</a>`)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		opts     []Option
+		expected []string
+	}{
+		{
+			expected: []string{"/", "/a/b/c", "/a/b", "/a"},
+		},
+
+		{
+			opts:     []Option{WithStrategy(StrategyDFS)},
+			expected: []string{"/", "/a", "/a/b", "/a/b/c"},
+		},
+
+		{
+			opts:     []Option{WithPriority(ShortPaths)},
+			expected: []string{"/", "/a", "/a/b", "/a/b/c"},
+		},
+
+		// page limits crawl the most valuable pages
+		{
+			opts:     []Option{WithPriority(ShortPaths), WithLimits(Limits{MaxPages: 2})},
+			expected: []string{"/", "/a"},
+		},
+	}
+
+	for _, c := range tests {
+		crawled = nil
+		opts := append([]Option{WithIgnoreRobots(true), WithWorkers(1)}, c.opts...)
+		_, err := New(opts...).Run(context.Background(), ts.URL+"/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if fmt.Sprint(crawled) != fmt.Sprint(c.expected) {
+			t.Fatalf("expected crawl order %v but got %v", c.expected, crawled)
+		}
+	}
+
+	if _, err := New(WithStrategy(StrategyPriority)).Run(context.Background(), ts.URL+"/"); err == nil {
+		t.Fatal("expected error for priority strategy without score func")
+	}
+
+	if _, err := New(WithStrategy("random")).Run(context.Background(), ts.URL+"/"); err == nil {
+		t.Fatal("expected error for unknown strategy")
+	}
+}
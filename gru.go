@@ -2,71 +2,140 @@ package scrape
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
 	"net/url"
 	"regexp"
+	"time"
 )
 
 // gru acts a medium for the minions and does the following
-// 1. Distributed the urls to minions
+// 1. Queues the urls for the minions to pull
 // 2. limit domain
 type gru struct {
-	baseURL        *url.URL            // starting url at maxDepth 0
-	minions        []*minion           // minions that are controlled by this gru
-	scrappedUnique map[string]int      // scrappedUnique holds the map of unique urls we crawled and times its repeated
-	unScrapped     map[int][]*url.URL  // unScrapped are those that are yet to be crawled by the minions
-	scrapped       map[int][]*url.URL  // scrapped holds url found in each depth
-	skippedURLs    map[string][]string // skippedURLs contains urls from different domains(if domainRegex is failed) and all invalid urls
-	errorURLs      map[string]error    // reason why this url was not crawled
-	submitDumpCh   chan *minionDumps   // submitDump listens for minions to submit their dumps
-	domainRegex    *regexp.Regexp      // restricts crawling the urls that pass the
-	maxDepth       int                 // maxDepth of crawl, -1 means no limit for maxDepth
-	interrupted    bool                // says if gru was interrupted while scraping
-	processors     []processor         // list of url processors
-}
-
-// minionPayload holds the urls for the minion to crawl and scrape
+	baseURL        *url.URL                  // starting url at maxDepth 0
+	seeds          []*url.URL                // seeds the crawl starts from at depth 0, baseURL being the first
+	sitemapSeeds   []*url.URL                // sitemapSeeds are the urls listed in the sitemaps of the seeds
+	lastMod        map[string]time.Time      // lastMod holds the Last-Modified of the crawled pages and the lastmod of the urls listed in the sitemaps
+	minions        []*minion                 // minions that are controlled by this gru
+	scrappedUnique map[string]int            // scrappedUnique holds the map of unique urls we crawled and times its repeated
+	unScrapped     *frontier                 // unScrapped are those that are yet to be crawled by the minions
+	scrapped       map[int][]*url.URL        // scrapped holds url found in each depth
+	skippedURLs    map[string][]string       // skippedURLs contains urls from different domains(if domainRegex is failed) and all invalid urls
+	errorURLs      map[string]error          // reason why this url was not crawled
+	disallowedURLs map[string]string         // disallowedURLs holds urls disallowed by robots.txt and the rule disallowing them
+	submitDumpCh   chan *minionDumps         // submitDump listens for minions to submit their dumps
+	payloadCh      chan *minionPayload       // payloadCh is the work queue the minions pull the urls from
+	pending        *minionPayload            // pending is the next payload waiting for a minion to pull it
+	domainRegex    *regexp.Regexp            // restricts crawling the urls that pass the
+	maxDepth       int                       // maxDepth of crawl, -1 means no limit for maxDepth
+	interrupted    bool                      // says if gru was interrupted while scraping
+	processors     []processor               // list of url processors
+	pool           *minionPool               // pool scales the minions at runtime. nil means fixed minions
+	limiter        *hostLimiter              // limiter enforces per host politeness. nil means no limits
+	wakeCh         chan struct{}             // wakeCh wakes up gru to distribute the deferred urls
+	retry          *RetryPolicy              // retry policy for transient failures. nil means no retries
+	retryQueue     []*retryURL               // retryQueue holds the urls waiting for their backoff to retry
+	attempts       map[string][]Attempt      // attempts holds the fetch attempts of urls that failed transiently
+	links          []Link                    // links holds the edges from crawled pages to the urls they link to
+	checkLinks     bool                      // checkLinks checks the urls failing domainRegex without crawling them
+	unChecked      *frontier                 // unChecked are those that are yet to be checked by the minions
+	inlinks        map[string]int            // inlinks holds the number of links found to each url
+	checkQueued    map[string]bool           // checkQueued holds the urls queued for checking
+	checkedURLs    map[string]*LinkCheck     // checkedURLs holds the result of the checked urls
+	redirects      map[string][]Redirect     // redirects holds the redirect chains of the urls that redirected
+	inFlight       map[string]inFlightURL    // inFlight holds the urls pushed to the minions and yet to be dumped
+	store          StateStore                // store the crawl state is saved to. nil means state is not saved
+	checkpoint     time.Duration             // checkpoint is the interval the state is saved at
+	resumed        bool                      // resumed is true if the crawl is restored from a saved state
+	marks          map[string][]string       // marks added to the urls by the processors
+	records        map[string]Record         // records extracted from the pages by the rules
+	hooks          Hooks                     // hooks called as the dumps are processed
+	urlRules       []*URLRule                // urlRules include or exclude the urls followed and recorded
+	filteredURLs   map[string]string         // filteredURLs holds the urls excluded by the url rules and the rule excluding them
+	limits         Limits                    // limits guarding the crawl against crawl traps
+	admitted       *admission                // admitted holds the urls admitted under the limits
+	limitedURLs    map[string]SkipReason     // limitedURLs holds the urls dropped by the limits and the limit they broke
+	deadline       time.Time                 // deadline after which no new urls are crawled. zero means no deadline
+	normalizer     Normalizer                // normalizer applied before deduping the urls. nil leaves them as is
+	relations      map[string]*PageRelations // relations holds the relations declared by the crawled pages
+	pages          map[string]PageInfo       // pages holds the pages crawled with 200 OK
+}
+
+// inFlightURL is an url pushed to a minion
+type inFlightURL struct {
+	depth  int    // depth at which the url is scrapped from
+	check  bool   // check is true if the url is only checked
+	source string // source is the page the url is found on
+}
+
+// minionPayload holds the url for the minion to crawl and scrape
 type minionPayload struct {
-	currentDepth int        // depth at which these urls are scrapped from
-	urls         []*url.URL // urls to be crawled
+	currentDepth int      // depth at which the url is scrapped from
+	url          *url.URL // url to be crawled
+	check        bool     // check the url without crawling it
 }
 
 // minionDump is the crawl dump by single minion of a given sourceURL
 type minionDump struct {
-	depth       int        // depth at which the urls are scrapped(+1 of sourceURL depth)
-	sourceURL   *url.URL   // sourceURL the minion crawled
-	urls        []*url.URL // urls obtained from sourceURL page
-	invalidURLs []string   // urls which couldn't be normalized
-	err         error      // reason why url is not crawled
+	depth        int                   // depth at which the urls are scrapped(+1 of sourceURL depth)
+	sourceURL    *url.URL              // sourceURL the minion crawled
+	urls         []*url.URL            // urls obtained from sourceURL page
+	links        []*extractedLink      // links obtained from sourceURL page along with where they are found
+	check        *LinkCheck            // check holds the result if the sourceURL is checked and not crawled
+	invalidURLs  []string              // urls which couldn't be normalized
+	err          error                 // reason why url is not crawled
+	latency      time.Duration         // time taken to crawl the sourceURL
+	disallowedBy string                // robots.txt rule that disallowed crawling the sourceURL
+	transient    bool                  // transient is true if the err is worth retrying
+	retryAfter   time.Duration         // retryAfter is the delay asked by the server before retrying
+	relations    *PageRelations        // relations declared by the sourceURL page
+	redirects    []Redirect            // redirects followed from the sourceURL
+	finalURL     *url.URL              // finalURL the sourceURL redirected to. nil if not redirected
+	offDomain    bool                  // offDomain is true if the sourceURL redirected to an url failing domainRegex
+	blocked      *blockedRedirectError // blocked says why the redirect of the sourceURL is not followed. nil if followed
+	page         *Page                 // page fetched from the sourceURL. nil if the page is not crawled
+	noindex      bool                  // noindex is true if the sourceURL page asks not to be indexed
 }
 
-// minionDumps holds the crawled data and chan to confirm that dumps are accepted
+// minionDumps holds the crawled data along with the minion that crawled it
 type minionDumps struct {
-	minion string
-	got    chan bool
+	minion *minion
 	mds    []*minionDump
 }
 
 // newGru returns a new gru with given base url and maxDepth
 func newGru(baseURL *url.URL, maxDepth int) *gru {
+	ps, _ := pipeline(nil, nil, nil)
 	g := &gru{
 		baseURL:        baseURL,
+		seeds:          []*url.URL{baseURL},
+		lastMod:        make(map[string]time.Time),
+		pages:          make(map[string]PageInfo),
 		scrappedUnique: make(map[string]int),
-		unScrapped:     make(map[int][]*url.URL),
+		unScrapped:     newFrontier(StrategyBFS, nil),
 		scrapped:       make(map[int][]*url.URL),
 		skippedURLs:    make(map[string][]string),
 		errorURLs:      make(map[string]error),
+		disallowedURLs: make(map[string]string),
+		attempts:       make(map[string][]Attempt),
+		unChecked:      newFrontier(StrategyBFS, nil),
+		inlinks:        make(map[string]int),
+		checkQueued:    make(map[string]bool),
+		checkedURLs:    make(map[string]*LinkCheck),
+		relations:      make(map[string]*PageRelations),
+		redirects:      make(map[string][]Redirect),
+		inFlight:       make(map[string]inFlightURL),
 		submitDumpCh:   make(chan *minionDumps),
+		payloadCh:      make(chan *minionPayload),
+		wakeCh:         make(chan struct{}, 1),
 		maxDepth:       maxDepth,
-		processors: []processor{
-			uniqueURLProcessor(),
-			errorCheckProcessor(),
-			skippedURLProcessor(),
-			maxDepthCheckProcessor(),
-			domainFilterProcessor(),
-		},
+		marks:          make(map[string][]string),
+		records:        make(map[string]Record),
+		filteredURLs:   make(map[string]string),
+		admitted:       newAdmission(),
+		limitedURLs:    make(map[string]SkipReason),
+		processors:     ps,
 	}
 
 	r, _ := regexp.Compile(baseURL.Hostname())
@@ -87,59 +156,111 @@ func setDomainRegex(g *gru, regexStr string) error {
 	return nil
 }
 
-// getIdleMinions will return all the idle minions
-func getIdleMinions(g *gru) (idleMinions []*minion) {
-	for _, m := range g.minions {
-		if isBusy(m) {
-			continue
-		}
-
-		idleMinions = append(idleMinions, m)
+// busyMinions returns the number of minions crawling the urls at the moment
+func busyMinions(g *gru) int {
+	busy := len(g.inFlight)
+	if g.pending != nil {
+		// pending payload is yet to be pulled by a minion
+		busy--
 	}
 
-	return idleMinions
+	return busy
 }
 
-// pushPayloadToMinion will push payload to minion
-func pushPayloadToMinion(m *minion, depth int, urls []*url.URL) {
-	m.payloadCh <- &minionPayload{
-		currentDepth: depth,
-		urls:         urls,
+// idleMinions returns the number of minions waiting for the urls
+func idleMinions(g *gru) int {
+	idle := len(g.minions) - busyMinions(g)
+	if idle < 0 {
+		// stopped minions may still be crawling their last url
+		return 0
 	}
+
+	return idle
 }
 
-// distributePayload will distribute the given urls to idle minions, error when there are no idle minions
-func distributePayload(g *gru, depth int, urls []*url.URL) error {
-	ims := getIdleMinions(g)
-	if len(ims) == 0 {
-		return errors.New("all minions are busy")
+// takeURL removes the next url from the queue that the host limits allow crawling now.
+// blocked holds the hosts that are already known to be limited.
+// wait is the shortest duration after which a rate limited url can be crawled, 0 if none are rate limited
+func takeURL(g *gru, queue *frontier, blocked map[string]bool) (depth int, u *url.URL, source string, wait time.Duration) {
+	if g.limiter == nil {
+		depth, u, source = popURL(queue, nil)
+		return depth, u, source, 0
 	}
 
-	if len(urls) <= len(ims) {
-		for i, u := range urls {
-			go pushPayloadToMinion(ims[i], depth, []*url.URL{u})
+	depth, u, source = popURL(queue, func(host string) bool {
+		if blocked[host] {
+			return false
 		}
-		return nil
-	}
 
-	wd := len(urls) / len(ims)
-	i := 0
-	for mi, m := range ims {
-		if mi+1 == len(ims) {
-			go pushPayloadToMinion(m, depth, urls[i:])
-			continue
+		ok, w := acquireHost(g.limiter, host)
+		if !ok {
+			blocked[host] = true
+			if w > 0 && (wait == 0 || w < wait) {
+				wait = w
+			}
 		}
 
-		go pushPayloadToMinion(m, depth, urls[i:i+wd])
-		i += wd
+		return ok
+	})
 
+	if u != nil {
+		wait = 0
 	}
-	return nil
+
+	return depth, u, source, wait
+}
+
+// nextPayload returns the next url the minions can pull. crawls are preferred over checks.
+// nil if there is no url to crawl at the moment along with the duration after which a rate limited url can be crawled
+func nextPayload(g *gru) (mp *minionPayload, wait time.Duration) {
+	blocked := make(map[string]bool)
+	for _, q := range []struct {
+		queue *frontier
+		check bool
+	}{{g.unScrapped, false}, {g.unChecked, true}} {
+		for {
+			d, u, src, w := takeURL(g, q.queue, blocked)
+			if w > 0 && (wait == 0 || w < wait) {
+				wait = w
+			}
+
+			if u == nil {
+				break
+			}
+
+			if !q.check && g.limits != (Limits{}) {
+				if reason := checkPageLimits(g.limits, g.admitted, u); reason != "" {
+					if g.limiter != nil {
+						refundHost(g.limiter, u.Host)
+					}
+
+					limitURL(g, src, u.String(), reason)
+					continue
+				}
+
+				admitPage(g.admitted, u)
+			}
+
+			g.inFlight[u.String()] = inFlightURL{depth: d, check: q.check, source: src}
+			return &minionPayload{currentDepth: d, url: u, check: q.check}, 0
+		}
+	}
+
+	return nil, wait
 }
 
 // processDump will process a single minionDump
 func processDump(g *gru, md *minionDump) {
-	g.scrapped[md.depth-1] = append(g.scrapped[md.depth-1], md.sourceURL)
+	source := g.inFlight[md.sourceURL.String()].source
+	delete(g.inFlight, md.sourceURL.String())
+	if g.limiter != nil {
+		releaseHost(g.limiter, md.sourceURL.Host)
+	}
+
+	if retryDump(g, md, source) {
+		return
+	}
+
 	for _, p := range g.processors {
 		r := p.process(g, md)
 		if !r {
@@ -149,7 +270,7 @@ func processDump(g *gru, md *minionDump) {
 
 	// add the md.urls to unscrapped and md.source to scraped
 	if len(md.urls) > 0 {
-		g.unScrapped[md.depth] = append(g.unScrapped[md.depth], md.urls...)
+		pushURLs(g.unScrapped, md.depth, md.sourceURL.String(), md.urls...)
 	}
 }
 
@@ -161,53 +282,108 @@ func processDumps(g *gru, mds []*minionDump) (finished bool) {
 	}
 	log.Println("processing done...")
 
-	if len(getIdleMinions(g)) < 1 {
-		log.Println("all minions are busy. deferring payload distribution...")
-		return false
+	requeueRetries(g)
+	enforceDeadline(g)
+	if g.pool != nil {
+		observeLatency(g.pool, mds)
+		scalePool(g)
 	}
 
-	if len(g.unScrapped) > 0 {
-		for d, urls := range g.unScrapped {
-			err := distributePayload(g, d, urls)
-			if err != nil {
-				log.Printf("failed to distribute load: %v\n", err)
-				break
-			}
-			delete(g.unScrapped, d)
-			log.Printf("distributed payload at depth: %d\n", d)
-		}
+	return crawlDone(g)
+}
 
+// crawlDone says if there are no more urls to crawl
+func crawlDone(g *gru) bool {
+	if g.unScrapped.Len() > 0 || g.unChecked.Len() > 0 || len(g.inFlight) > 0 || len(g.retryQueue) > 0 {
 		return false
 	}
 
-	if len(getIdleMinions(g)) == len(g.minions) && len(g.unScrapped) == 0 {
-		log.Println("scrapping done...")
-		return true
-	}
+	log.Println("scrapping done...")
+	return true
+}
 
-	log.Println("no urls to scrape at the moment...")
-	return false
+// scheduleWake wakes up gru after the given duration
+func scheduleWake(g *gru, after time.Duration) {
+	time.AfterFunc(after, func() {
+		select {
+		case g.wakeCh <- struct{}{}:
+		default:
+		}
+	})
 }
 
 // startGru initiates gru to start scraping
 func startGru(ctx context.Context, g *gru) {
 	log.Printf("Starting Gru with Base URL: %s\n", g.baseURL)
-	distributePayload(g, 0, []*url.URL{g.baseURL})
+	if !g.resumed {
+		for _, u := range append(g.seeds, g.sitemapSeeds...) {
+			pushURLs(g.unScrapped, 0, "", u)
+			admitVariant(g.admitted, u)
+		}
+	}
+
+	if !g.deadline.IsZero() {
+		scheduleWake(g, time.Until(g.deadline))
+	}
+
+	// state is saved periodically and once more when gru stops
+	var tick <-chan time.Time
+	if g.store != nil {
+		t := time.NewTicker(g.checkpoint)
+		defer t.Stop()
+		tick = t.C
+	}
+	defer checkpoint(g)
+
+	if processDumps(g, nil) {
+		log.Println("stopping gru...")
+		return
+	}
 
 	for {
+		// payloadCh is only set when there is a payload so that gru doesn't block on it otherwise
+		var payloadCh chan<- *minionPayload
+		if g.pending == nil {
+			var wait time.Duration
+			g.pending, wait = nextPayload(g)
+			if wait > 0 {
+				log.Printf("hosts are rate limited. waking up in %v\n", wait)
+				scheduleWake(g, wait)
+			}
+
+			// the rest of the queued urls may have been dropped by the limits
+			if g.pending == nil && crawlDone(g) {
+				log.Println("stopping gru...")
+				return
+			}
+		}
+
+		if g.pending != nil {
+			payloadCh = g.payloadCh
+		}
+
 		select {
+		case <-tick:
+			checkpoint(g)
 		case <-ctx.Done():
 			log.Println("scrapping interrupted...")
 			g.interrupted = true
 			return
+		case payloadCh <- g.pending:
+			g.pending = nil
 		case mds := <-g.submitDumpCh:
-			go func(got chan<- bool) { got <- true }(mds.got)
-			log.Printf("got new dump from %s\n", mds.minion)
+			log.Printf("got new dump from %s\n", mds.minion.name)
 			done := processDumps(g, mds.mds)
 			if done {
 				log.Println("stopping gru...")
 				return
 			}
+		case <-g.wakeCh:
+			done := processDumps(g, nil)
+			if done {
+				log.Println("stopping gru...")
+				return
+			}
 		}
 	}
 }
@@ -1,134 +1,135 @@
 package scrape
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"sync"
 	"testing"
+	"time"
 )
 
-func Test_getIdleMinions(t *testing.T) {
-	g := &gru{
-		minions: []*minion{
-			{
-				name: "minion 1",
-				busy: true,
-				mu:   &sync.RWMutex{},
-			},
-
-			{
-				name: "minion 2",
-				mu:   &sync.RWMutex{},
-			},
-
-			{
-				name: "minion 3",
-				mu:   &sync.RWMutex{},
-			},
-
-			{
-				name: "minion 4",
-				busy: true,
-				mu:   &sync.RWMutex{},
-			},
-		},
+func Test_idleMinions(t *testing.T) {
+	baseURL, _ := url.Parse("http://test.com")
+	g := newGru(baseURL, 1)
+	for i := 0; i < 4; i++ {
+		g.minions = append(g.minions, newMinion(minionName(i), newCrawlConfig(http.DefaultClient), g.payloadCh, g.submitDumpCh))
 	}
 
-	expectedIdleMinions := map[string]bool{
-		"minion 2": true,
-		"minion 3": true,
+	g.inFlight["http://test.com/1"] = inFlightURL{depth: 1}
+	g.inFlight["http://test.com/2"] = inFlightURL{depth: 1}
+	if idle := idleMinions(g); idle != 2 {
+		t.Fatalf("expected 2 idle minions but got %d", idle)
 	}
 
-	idleMinions := getIdleMinions(g)
-	if len(idleMinions) != len(expectedIdleMinions) {
-		t.Fatalf("expected idle minions %d but got %d", len(expectedIdleMinions), len(idleMinions))
+	// pending payload is not pulled by any minion yet
+	u, _ := url.Parse("http://test.com/3")
+	g.pending = &minionPayload{currentDepth: 1, url: u}
+	g.inFlight[u.String()] = inFlightURL{depth: 1}
+	if idle := idleMinions(g); idle != 2 {
+		t.Fatalf("expected 2 idle minions but got %d", idle)
 	}
 
-	for _, m := range idleMinions {
-		_, ok := expectedIdleMinions[m.name]
-		if !ok {
-			t.Fatalf("expected %s to be idle but busy\n", m.name)
-		}
+	g.minions = g.minions[:1]
+	if idle := idleMinions(g); idle != 0 {
+		t.Fatalf("expected no idle minions but got %d", idle)
 	}
 }
 
-func Test_distributePayload(t *testing.T) {
-	tests := []struct {
-		minions int
-		busy    int
-		urls    int
-	}{
-		{
-			minions: 4,
-			busy:    4,
-		},
-
-		{
-			minions: 5,
-			urls:    4,
-		},
-
-		{
-			minions: 5,
-			busy:    1,
-			urls:    4,
-		},
-
-		{
-			minions: 5,
-			urls:    10,
-		},
-	}
-
-	minionCreateF := func(g *gru, total, busy int) (minions []*minion) {
-		for i := 0; i < total; i++ {
-			minions = append(minions, newMinion(fmt.Sprintf("minion %d", i), g.submitDumpCh))
+func Test_nextPayload(t *testing.T) {
+	baseURL, _ := url.Parse("http://test.com")
+	g := newGru(baseURL, 1)
+	g.limiter, _ = newHostLimiter(HostLimit{MaxInFlight: 2}, nil)
+	urls, _ := urlStrToURLs([]string{
+		"http://test.com/1",
+		"http://test.com/2",
+		"http://test.com/3",
+		"http://vedhavyas.com/1",
+	})
+	pushURLs(g.unScrapped, 1, "", urls...)
+	checks, _ := urlStrToURLs([]string{"http://github.com/"})
+	pushURLs(g.unChecked, 2, "", checks...)
+
+	var got []string
+	for {
+		mp, wait := nextPayload(g)
+		if mp == nil {
+			if wait != 0 {
+				t.Fatalf("expected no wait for in flight caps but got %v", wait)
+			}
+
+			break
 		}
 
-		for i := 0; i < busy; i++ {
-			minions[i].busy = true
-		}
+		got = append(got, fmt.Sprintf("%d %s %t", mp.currentDepth, mp.url, mp.check))
+	}
 
-		return minions
+	expected := []string{
+		"1 http://test.com/1 false",
+		"1 http://test.com/2 false",
+		"1 http://vedhavyas.com/1 false",
+		"2 http://github.com/ true",
 	}
 
-	urlCreateF := func(total int) (urls []*url.URL) {
-		for i := 0; i < total; i++ {
-			u, _ := url.Parse(fmt.Sprintf("http://test.com/%d", i))
-			urls = append(urls, u)
-		}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("expected payloads %v but got %v", expected, got)
+	}
 
-		return urls
+	queued := frontierURLs(g.unScrapped)
+	if len(g.inFlight) != 4 || len(queued[1]) != 1 || queued[1][0].String() != "http://test.com/3" {
+		t.Fatalf("expected http://test.com/3 to be deferred but got %v in flight and %v queued", g.inFlight, queued)
 	}
 
-	for _, c := range tests {
-		baseURL, _ := url.Parse("http://test.com")
-		g := newGru(baseURL, 1)
-		g.minions = minionCreateF(g, c.minions, c.busy)
-		urls := urlCreateF(c.urls)
-
-		testCh := make(chan int)
-		for _, m := range g.minions {
-			go func(m *minion) {
-				for mp := range m.payloadCh {
-					testCh <- len(mp.urls)
-				}
-			}(m)
-		}
-		distributePayload(g, 1, urls)
+	// releasing the host lets the deferred url through
+	releaseHost(g.limiter, "test.com")
+	mp, _ := nextPayload(g)
+	if mp == nil || mp.url.String() != "http://test.com/3" || g.unScrapped.Len() != 0 {
+		t.Fatalf("expected http://test.com/3 but got %v", mp)
+	}
+}
 
-		count := 0
-		busyMinions := c.urls
-		if busyMinions > (c.minions - c.busy) {
-			busyMinions = c.minions - c.busy
-		}
-		for i := 0; i < busyMinions; i++ {
-			count += <-testCh
+func TestCrawler_RunSkewed(t *testing.T) {
+	// a single slow page must not hold back the fast ones queued along with it
+	var mu sync.Mutex
+	crawled := make(map[string]time.Time)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			for i := 0; i < 20; i++ {
+				fmt.Fprintf(w, `<a href="/%d">%d</a>`, i, i)
+			}
+		case "/0":
+			time.Sleep(500 * time.Millisecond)
 		}
 
-		if c.urls != count {
-			t.Fatalf("expected %d urls but got %d", c.urls, count)
+		mu.Lock()
+		crawled[r.URL.Path] = time.Now()
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	st := time.Now()
+	resp, err := New(WithIgnoreRobots(true), WithWorkers(2), WithMaxDepth(2)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(resp.UniqueURLs) != 21 {
+		t.Fatalf("expected 21 urls to be crawled but got %d", len(resp.UniqueURLs))
+	}
+
+	// the fast pages are crawled by the other minion while the slow page is loading
+	slow := crawled["/0"]
+	for p, at := range crawled {
+		if p != "/0" && at.After(slow) {
+			t.Fatalf("expected %s to be crawled before the slow page: %v", p, crawled)
 		}
+	}
 
+	if d := time.Since(st); d > time.Second {
+		t.Fatalf("expected crawl to finish with the slow page but took %v", d)
 	}
 }
@@ -0,0 +1,70 @@
+package scrape
+
+import (
+	"net/http"
+	"time"
+)
+
+// SkipReason says why an url is not crawled
+type SkipReason string
+
+// Reasons an url is skipped
+const (
+	SkipInvalid    SkipReason = "invalid"    // url couldn't be resolved
+	SkipDomain     SkipReason = "domain"     // url, or its redirect target, fails domainRegex
+	SkipDisallowed SkipReason = "disallowed" // url is disallowed by robots.txt
+	SkipFiltered   SkipReason = "filtered"   // url is excluded by the url rules
+)
+
+// Page is a crawled page along with its content
+type Page struct {
+	URL         string         // URL that is crawled
+	FinalURL    string         // FinalURL the page is served from. same as URL if not redirected
+	Depth       int            // Depth the page is found at
+	StatusCode  int            // StatusCode of the response
+	Header      http.Header    // Header of the response
+	ContentType string         // ContentType of the response
+	Body        []byte         // Body of the page capped to the max body size. nil if bodies are not retained
+	Truncated   bool           // Truncated is true if the body is larger than the max body size
+	Redirects   []Redirect     // Redirects followed to reach the page
+	Links       []Link         // Links found in the page
+	Relations   *PageRelations // Relations declared by the page. nil if none
+	Record      Record         // Record extracted by the rules. nil if no rule matched
+	Latency     time.Duration  // Latency to fetch the page
+}
+
+// Hooks are called as the minion dumps are processed, while the crawl is running.
+// Hooks are called from a single goroutine and block the crawl, so slow hooks should hand off the work.
+// nil hooks are not called
+type Hooks struct {
+	OnPage  func(p *Page)                             // OnPage is called for every page crawled
+	OnError func(u string, err error)                 // OnError is called for every url failed to crawl
+	OnSkip  func(source, u string, reason SkipReason) // OnSkip is called for every url skipped from the source page
+	OnCheck func(lc *LinkCheck)                       // OnCheck is called for every url checked without crawling
+}
+
+// newPage completes the page fetched by the minion with the links found and the latency
+func newPage(md *minionDump) *Page {
+	p := md.page
+	p.Depth = md.depth - 1
+	p.Redirects = md.redirects
+	p.Relations = md.relations
+	p.Latency = md.latency
+	p.Links = nil
+	for _, l := range md.links {
+		p.Links = append(p.Links, newLink(p.FinalURL, l))
+	}
+
+	return p
+}
+
+// emitSkip calls the OnSkip hook for the skipped urls
+func emitSkip(g *gru, source string, urls []string, reason SkipReason) {
+	if g.hooks.OnSkip == nil {
+		return
+	}
+
+	for _, u := range urls {
+		g.hooks.OnSkip(source, u, reason)
+	}
+}
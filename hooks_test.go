@@ -0,0 +1,65 @@
+package scrape
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestCrawler_RunHooks(t *testing.T) {
+	ts := redirectServer()
+	defer ts.Close()
+
+	pages := make(map[string]*Page)
+	errs := make(map[string]error)
+	skipped := make(map[string]SkipReason)
+	hooks := Hooks{
+		OnPage:  func(p *Page) { pages[p.FinalURL] = p },
+		OnError: func(u string, err error) { errs[u] = err },
+		OnSkip:  func(source, u string, reason SkipReason) { skipped[u] = reason },
+	}
+
+	resp, err := New(WithWorkers(2), WithIgnoreRobots(true), WithHooks(hooks)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(pages) != 3 {
+		t.Fatalf("expected 3 pages but got %v", pages)
+	}
+
+	home := pages[ts.URL+"/"]
+	if home == nil || home.Depth != 0 || len(home.Links) != 4 || home.Links[0].Target != ts.URL+"/old" {
+		t.Fatalf("unexpected home page: %+v", home)
+	}
+
+	// either of /old and /moved may reach /docs/new first
+	if p := pages[ts.URL+"/docs/new"]; p == nil || p.Depth != 1 || len(p.Redirects) < 1 || p.URL != p.Redirects[0].From || len(p.Body) == 0 {
+		t.Fatalf("expected redirected page with redirects but got %+v", p)
+	}
+
+	if len(errs) != len(resp.ErrorURLs) || errs[ts.URL+"/loop"] == nil {
+		t.Fatalf("expected errors %v but got %v", resp.ErrorURLs, errs)
+	}
+
+	if skipped["http://example.com/"] != SkipDomain {
+		t.Fatalf("expected off domain redirect to be skipped but got %v", skipped)
+	}
+}
+
+func TestProcessor_linkCheckProcessorHook(t *testing.T) {
+	bu, _ := url.Parse("http://test.com/")
+	g := newGru(bu, -1)
+	var checked []*LinkCheck
+	g.hooks.OnCheck = func(lc *LinkCheck) { checked = append(checked, lc) }
+
+	lc := &LinkCheck{URL: "http://other.com/", StatusCode: 200}
+	u, _ := url.Parse(lc.URL)
+	if linkCheckProcessor().process(g, &minionDump{sourceURL: u, check: lc}) {
+		t.Fatal("expected checked dump not to proceed")
+	}
+
+	if len(checked) != 1 || checked[0] != lc {
+		t.Fatalf("expected check hook to be called with %v but got %v", lc, checked)
+	}
+}
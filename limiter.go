@@ -0,0 +1,146 @@
+package scrape
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+)
+
+// HostLimit limits the requests made to the hosts matching the Pattern
+type HostLimit struct {
+	Pattern     string  // Pattern is the regex matched against the host. Empty matches all hosts
+	Rate        float64 // Rate of requests per second to a single host. 0 means no limit
+	Burst       int     // Burst of requests allowed above the Rate. Defaults to 1
+	MaxInFlight int     // MaxInFlight requests to a single host. 0 means no limit
+}
+
+// hostLimit is the compiled HostLimit
+type hostLimit struct {
+	HostLimit
+	regex *regexp.Regexp
+}
+
+// hostState holds the token bucket and in flight requests of a single host
+type hostState struct {
+	limit    *hostLimit // limit that applies to the host
+	tokens   float64    // tokens available in the bucket
+	last     time.Time  // last time the tokens were refilled
+	inFlight int        // inFlight urls handed to minions and not yet dumped
+}
+
+// hostLimiter enforces the per host rate limits and concurrency caps.
+// Only accessed by the gru and hence not safe for concurrent use
+type hostLimiter struct {
+	limits []*hostLimit          // limits are matched in order
+	def    *hostLimit            // def applies to hosts that do not match any of the limits
+	hosts  map[string]*hostState // hosts holds the state of each host seen
+	now    func() time.Time      // now returns current time
+}
+
+// newHostLimiter returns a limiter with default limit and per host pattern limits
+func newHostLimiter(def HostLimit, limits []HostLimit) (*hostLimiter, error) {
+	hl := &hostLimiter{
+		def:   &hostLimit{HostLimit: def},
+		hosts: make(map[string]*hostState),
+		now:   time.Now,
+	}
+
+	for _, l := range limits {
+		r, err := regexp.Compile(l.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile host limit pattern: %v", err)
+		}
+
+		hl.limits = append(hl.limits, &hostLimit{HostLimit: l, regex: r})
+	}
+
+	return hl, nil
+}
+
+// stateForHost returns the state of the host creating one if not present
+func stateForHost(hl *hostLimiter, host string) *hostState {
+	hs, ok := hl.hosts[host]
+	if ok {
+		return hs
+	}
+
+	limit := hl.def
+	for _, l := range hl.limits {
+		if l.regex.MatchString(host) {
+			limit = l
+			break
+		}
+	}
+
+	hs = &hostState{
+		limit:  limit,
+		tokens: float64(burst(limit)),
+		last:   hl.now(),
+	}
+	hl.hosts[host] = hs
+	return hs
+}
+
+// burst returns the bucket size of the limit
+func burst(l *hostLimit) int {
+	if l.Burst < 1 {
+		return 1
+	}
+
+	return l.Burst
+}
+
+// acquireHost takes a token and an in flight slot of the host.
+// If not available, returns the duration after which a token will be available.
+// wait is 0 when the host is capped by in flight requests
+func acquireHost(hl *hostLimiter, host string) (ok bool, wait time.Duration) {
+	hs := stateForHost(hl, host)
+	if hs.limit.MaxInFlight > 0 && hs.inFlight >= hs.limit.MaxInFlight {
+		return false, 0
+	}
+
+	if hs.limit.Rate > 0 {
+		now := hl.now()
+		hs.tokens += now.Sub(hs.last).Seconds() * hs.limit.Rate
+		if b := float64(burst(hs.limit)); hs.tokens > b {
+			hs.tokens = b
+		}
+		hs.last = now
+
+		if hs.tokens < 1 {
+			return false, time.Duration((1 - hs.tokens) / hs.limit.Rate * float64(time.Second))
+		}
+
+		hs.tokens--
+	}
+
+	hs.inFlight++
+	return true, 0
+}
+
+// refundHost gives back the token and the in flight slot taken by acquireHost for an url that is not crawled
+func refundHost(hl *hostLimiter, host string) {
+	hs, ok := hl.hosts[host]
+	if !ok {
+		return
+	}
+
+	if hs.inFlight > 0 {
+		hs.inFlight--
+	}
+
+	if hs.limit.Rate > 0 {
+		hs.tokens = math.Min(hs.tokens+1, float64(burst(hs.limit)))
+	}
+}
+
+// releaseHost frees the in flight slot of the host
+func releaseHost(hl *hostLimiter, host string) {
+	hs, ok := hl.hosts[host]
+	if !ok || hs.inFlight == 0 {
+		return
+	}
+
+	hs.inFlight--
+}
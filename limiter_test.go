@@ -0,0 +1,88 @@
+package scrape
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func Test_acquireHost(t *testing.T) {
+	hl, err := newHostLimiter(HostLimit{Rate: 2, Burst: 2}, []HostLimit{
+		{Pattern: `^slow\.`, Rate: 1},
+		{Pattern: `^capped\.`, MaxInFlight: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	hl.now = func() time.Time { return now }
+
+	tests := []struct {
+		host    string
+		advance time.Duration
+		release bool
+		refund  bool
+		ok      bool
+		wait    time.Duration
+	}{
+		{host: "test.com", ok: true},
+		{host: "test.com", ok: true},
+		{host: "test.com", wait: 500 * time.Millisecond},
+		{host: "test.com", advance: 500 * time.Millisecond, ok: true},
+		{host: "test.com", refund: true, ok: true},
+		{host: "slow.test.com", ok: true},
+		{host: "slow.test.com", wait: time.Second},
+		{host: "capped.test.com", ok: true},
+		{host: "capped.test.com"},
+		{host: "capped.test.com", release: true, ok: true},
+	}
+
+	for i, c := range tests {
+		now = now.Add(c.advance)
+		if c.release {
+			releaseHost(hl, c.host)
+		}
+
+		if c.refund {
+			refundHost(hl, c.host)
+		}
+
+		ok, wait := acquireHost(hl, c.host)
+		if ok != c.ok || wait != c.wait {
+			t.Fatalf("%d: expected %t and wait %v but got %t and %v", i, c.ok, c.wait, ok, wait)
+		}
+	}
+}
+
+func Test_newHostLimiter(t *testing.T) {
+	if _, err := newHostLimiter(HostLimit{}, []HostLimit{{Pattern: "["}}); err == nil {
+		t.Fatal("expected invalid pattern error")
+	}
+}
+
+func TestCrawler_RunWithRateLimit(t *testing.T) {
+	ts := testServer()
+	defer ts.Close()
+
+	st := time.Now()
+	resp, err := New(WithRateLimit(20), WithPerHostConcurrency(1)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(resp.UniqueURLs) != 4 {
+		t.Fatalf("expected 4 unique urls but got %v", resp.UniqueURLs)
+	}
+
+	// robots.txt is not rate limited, at least 3 of the pages are
+	if took := time.Since(st); took < 3*50*time.Millisecond {
+		t.Fatalf("expected crawl to be rate limited but took %v", took)
+	}
+
+	u, _ := url.Parse(ts.URL)
+	if _, err := New(WithHostLimits(HostLimit{Pattern: "["})).Run(context.Background(), u.String()); err == nil {
+		t.Fatal("expected invalid host limit error")
+	}
+}
@@ -0,0 +1,191 @@
+package scrape
+
+import (
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Reasons an url is skipped by the limits
+const (
+	SkipMaxPages        SkipReason = "max-pages"          // total pages limit is reached
+	SkipMaxPagesPerHost SkipReason = "max-pages-per-host" // pages limit of the host is reached
+	SkipURLLength       SkipReason = "url-length"         // url is longer than the max url length
+	SkipSegmentRepeats  SkipReason = "segment-repeats"    // a path segment repeats more than allowed
+	SkipQueryVariants   SkipReason = "query-variants"     // path has more query variants than allowed
+	SkipMaxDuration     SkipReason = "max-duration"       // crawl duration limit is reached
+)
+
+// Limits are the guard rails stopping the crawl from running forever on crawl traps. 0 means no limit
+type Limits struct {
+	MaxPages          int           // MaxPages crawled in total, including the seed
+	MaxPagesPerHost   int           // MaxPagesPerHost crawled from a single host
+	MaxURLLength      int           // MaxURLLength of the urls followed
+	MaxSegmentRepeats int           // MaxSegmentRepeats is the max times a path segment can appear in an url, such as /a/b/a/b
+	MaxQueryVariants  int           // MaxQueryVariants is the max distinct queries followed for a single path
+	MaxDuration       time.Duration // MaxDuration of the crawl after which no new urls are crawled
+}
+
+// admission tracks the urls admitted to enforce the limits
+type admission struct {
+	pages    map[string]bool            // pages holds the urls sent to the minions to crawl
+	hosts    map[string]int             // hosts holds the pages crawled per host
+	variants map[string]map[string]bool // variants holds the queries followed per host and path
+}
+
+// newAdmission returns an empty admission
+func newAdmission() *admission {
+	return &admission{
+		pages:    make(map[string]bool),
+		hosts:    make(map[string]int),
+		variants: make(map[string]map[string]bool),
+	}
+}
+
+// admitVariant records the query of the url as followed for its path
+func admitVariant(a *admission, u *url.URL) {
+	key := u.Host + u.EscapedPath()
+	if a.variants[key] == nil {
+		a.variants[key] = make(map[string]bool)
+	}
+
+	a.variants[key][u.RawQuery] = true
+}
+
+// admitPage records the url as crawled. urls crawled again, such as retries, are counted once
+func admitPage(a *admission, u *url.URL) {
+	if a.pages[u.String()] {
+		return
+	}
+
+	a.pages[u.String()] = true
+	a.hosts[u.Host]++
+}
+
+// maxSegmentRepeats returns the max times any segment appears in the path
+func maxSegmentRepeats(path string) (max int) {
+	counts := make(map[string]int)
+	for _, s := range strings.Split(path, "/") {
+		if s == "" {
+			continue
+		}
+
+		counts[s]++
+		if counts[s] > max {
+			max = counts[s]
+		}
+	}
+
+	return max
+}
+
+// checkURLLimits returns the limit the url breaks if followed. empty if none
+func checkURLLimits(l Limits, a *admission, u *url.URL) SkipReason {
+	if l.MaxURLLength > 0 && len(u.String()) > l.MaxURLLength {
+		return SkipURLLength
+	}
+
+	if l.MaxSegmentRepeats > 0 && maxSegmentRepeats(u.Path) > l.MaxSegmentRepeats {
+		return SkipSegmentRepeats
+	}
+
+	if l.MaxQueryVariants > 0 {
+		variants := a.variants[u.Host+u.EscapedPath()]
+		if !variants[u.RawQuery] && len(variants) >= l.MaxQueryVariants {
+			return SkipQueryVariants
+		}
+	}
+
+	return ""
+}
+
+// checkPageLimits returns the limit the url breaks if crawled. empty if none.
+// pages are limited when they are about to be crawled so that the strategy decides the pages crawled
+func checkPageLimits(l Limits, a *admission, u *url.URL) SkipReason {
+	if a.pages[u.String()] {
+		return ""
+	}
+
+	if l.MaxPagesPerHost > 0 && a.hosts[u.Host] >= l.MaxPagesPerHost {
+		return SkipMaxPagesPerHost
+	}
+
+	if l.MaxPages > 0 && len(a.pages) >= l.MaxPages {
+		return SkipMaxPages
+	}
+
+	return ""
+}
+
+// limitURL records the url as limited for the reason.
+// urls without a known source, such as the seeds, are reported from the base url
+func limitURL(g *gru, source, u string, reason SkipReason) {
+	if source == "" {
+		source = g.baseURL.String()
+	}
+
+	g.limitedURLs[u] = reason
+	emitSkip(g, source, []string{u}, reason)
+}
+
+// limitsProcessor removes the urls breaking the limits from the urls followed
+func limitsProcessor() processor {
+	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
+		if g.limits == (Limits{}) {
+			return true
+		}
+
+		var urls []*url.URL
+		for _, u := range md.urls {
+			if reason := checkURLLimits(g.limits, g.admitted, u); reason != "" {
+				limitURL(g, md.sourceURL.String(), u.String(), reason)
+				continue
+			}
+
+			admitVariant(g.admitted, u)
+			urls = append(urls, u)
+		}
+
+		md.urls = urls
+		return true
+	})
+}
+
+// enforceDeadline drops the queued urls once the max crawl duration is reached.
+// returns true if the deadline is reached
+func enforceDeadline(g *gru) bool {
+	if g.deadline.IsZero() || time.Now().Before(g.deadline) {
+		return false
+	}
+
+	drop := func(queue *frontier) {
+		for _, it := range clearFrontier(queue) {
+			limitURL(g, it.source, it.u.String(), SkipMaxDuration)
+		}
+	}
+
+	if g.unScrapped.Len() > 0 || g.unChecked.Len() > 0 || len(g.retryQueue) > 0 || g.pending != nil {
+		log.Println("max crawl duration reached. dropping the queued urls...")
+	}
+
+	if mp := g.pending; mp != nil {
+		source := g.inFlight[mp.url.String()].source
+		delete(g.inFlight, mp.url.String())
+		if g.limiter != nil {
+			releaseHost(g.limiter, mp.url.Host)
+		}
+
+		limitURL(g, source, mp.url.String(), SkipMaxDuration)
+		g.pending = nil
+	}
+
+	drop(g.unScrapped)
+	drop(g.unChecked)
+	for _, r := range g.retryQueue {
+		limitURL(g, r.source, r.u.String(), SkipMaxDuration)
+	}
+
+	g.retryQueue = nil
+	return true
+}
@@ -0,0 +1,111 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_checkLimits(t *testing.T) {
+	a := newAdmission()
+	for _, r := range []string{"https://a.com/", "https://a.com/list?page=1", "https://b.com/"} {
+		u, _ := url.Parse(r)
+		admitVariant(a, u)
+		admitPage(a, u)
+	}
+
+	tests := []struct {
+		limits Limits
+		url    string
+		result SkipReason
+	}{
+		{url: "https://a.com/" + strings.Repeat("x", 100)},
+		{limits: Limits{MaxURLLength: 20}, url: "https://a.com/" + strings.Repeat("x", 10), result: SkipURLLength},
+		{limits: Limits{MaxSegmentRepeats: 2}, url: "https://a.com/a/b/a/b"},
+		{limits: Limits{MaxSegmentRepeats: 2}, url: "https://a.com/a/b/a/b/a", result: SkipSegmentRepeats},
+		{limits: Limits{MaxQueryVariants: 1}, url: "https://a.com/list?page=1"},
+		{limits: Limits{MaxQueryVariants: 1}, url: "https://a.com/list?page=2", result: SkipQueryVariants},
+		{limits: Limits{MaxQueryVariants: 1}, url: "https://a.com/other?page=2"},
+		{limits: Limits{MaxPagesPerHost: 2}, url: "https://b.com/1"},
+		{limits: Limits{MaxPagesPerHost: 2}, url: "https://a.com/1", result: SkipMaxPagesPerHost},
+		{limits: Limits{MaxPagesPerHost: 2}, url: "https://a.com/"},
+		{limits: Limits{MaxPages: 4}, url: "https://c.com/"},
+		{limits: Limits{MaxPages: 3}, url: "https://c.com/", result: SkipMaxPages},
+	}
+
+	for _, c := range tests {
+		u, _ := url.Parse(c.url)
+		r := checkURLLimits(c.limits, a, u)
+		if r == "" {
+			r = checkPageLimits(c.limits, a, u)
+		}
+
+		if r != c.result {
+			t.Fatalf("expected %s to be limited by %q but got %q", c.url, c.result, r)
+		}
+	}
+}
+
+func TestCrawler_RunLimits(t *testing.T) {
+	// every page links to a deeper page and to a calendar with endless months
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/calendar" {
+			month := 0
+			fmt.Sscanf(r.URL.Query().Get("month"), "%d", &month)
+			fmt.Fprintf(w, `<a href="/calendar?month=%d">next</a>`, month+1)
+			return
+		}
+
+		fmt.Fprintf(w, `<a href="%sa/">deeper</a><a href="/calendar?month=1">calendar</a>`, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		limits  Limits
+		crawled int
+		reason  SkipReason
+	}{
+		{limits: Limits{MaxPages: 5}, crawled: 5, reason: SkipMaxPages},
+		{limits: Limits{MaxSegmentRepeats: 3, MaxQueryVariants: 2}, crawled: 6, reason: SkipSegmentRepeats},
+		{limits: Limits{MaxDuration: time.Nanosecond}, crawled: 0, reason: SkipMaxDuration},
+	}
+
+	for _, c := range tests {
+		// limited pages are reported from the page linking them
+		sources := make(map[string]string)
+		hooks := Hooks{OnSkip: func(source, u string, reason SkipReason) { sources[u] = source }}
+		resp, err := New(WithIgnoreRobots(true), WithLimits(c.limits), WithHooks(hooks)).Run(context.Background(), ts.URL+"/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for u, source := range sources {
+			if strings.Contains(u, "/calendar") || u == ts.URL+"/" {
+				continue
+			}
+
+			if expected := strings.TrimSuffix(u, "a/"); source != expected {
+				t.Fatalf("expected %s to be limited from %s but got %s", u, expected, source)
+			}
+		}
+
+		if len(resp.UniqueURLs) != c.crawled {
+			t.Fatalf("expected %d urls to be crawled but got %v", c.crawled, resp.UniqueURLs)
+		}
+
+		found := false
+		for _, r := range resp.LimitedURLs {
+			found = found || r == c.reason
+		}
+
+		if !found {
+			t.Fatalf("expected urls to be limited by %s but got %v", c.reason, resp.LimitedURLs)
+		}
+	}
+}
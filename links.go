@@ -0,0 +1,103 @@
+package scrape
+
+import (
+	"regexp"
+	"strings"
+)
+
+// LinkKind is the element and attribute a link is found in
+type LinkKind string
+
+// Kinds of links extracted from the page
+const (
+	AnchorHref   LinkKind = "a[href]"
+	AreaHref     LinkKind = "area[href]"
+	ImgSrc       LinkKind = "img[src]"
+	ImgSrcset    LinkKind = "img[srcset]"
+	LinkHref     LinkKind = "link[href]"
+	ScriptSrc    LinkKind = "script[src]"
+	IframeSrc    LinkKind = "iframe[src]"
+	FormAction   LinkKind = "form[action]"
+	SourceSrc    LinkKind = "source[src]"
+	SourceSrcset LinkKind = "source[srcset]"
+	VideoSrc     LinkKind = "video[src]"
+	AudioSrc     LinkKind = "audio[src]"
+	MetaRefresh  LinkKind = "meta[http-equiv=refresh]"
+	CSSURL       LinkKind = "css[url]" // url(...) in style attributes and style elements
+)
+
+// AllLinkKinds holds all the kinds of links that can be extracted
+var AllLinkKinds = []LinkKind{
+	AnchorHref, AreaHref, ImgSrc, ImgSrcset, LinkHref, ScriptSrc, IframeSrc, FormAction,
+	SourceSrc, SourceSrcset, VideoSrc, AudioSrc, MetaRefresh, CSSURL,
+}
+
+// DefaultFollowKinds are the kinds of links followed by default. Rest are only recorded
+var DefaultFollowKinds = []LinkKind{AnchorHref, AreaHref, IframeSrc, MetaRefresh}
+
+// linkAttrs maps the element and its attributes to the kind of link they hold
+var linkAttrs = map[string]map[string]LinkKind{
+	"a":      {"href": AnchorHref},
+	"area":   {"href": AreaHref},
+	"img":    {"src": ImgSrc, "srcset": ImgSrcset},
+	"link":   {"href": LinkHref},
+	"script": {"src": ScriptSrc},
+	"iframe": {"src": IframeSrc},
+	"form":   {"action": FormAction},
+	"source": {"src": SourceSrc, "srcset": SourceSrcset},
+	"video":  {"src": VideoSrc},
+	"audio":  {"src": AudioSrc},
+}
+
+// cssURLRegex matches url(...) in css
+var cssURLRegex = regexp.MustCompile(`url\(\s*['"]?([^'"()]+?)['"]?\s*\)`)
+
+// kindsToSet converts the kinds to a set
+func kindsToSet(kinds []LinkKind) map[LinkKind]bool {
+	set := make(map[LinkKind]bool)
+	for _, k := range kinds {
+		set[k] = true
+	}
+
+	return set
+}
+
+// parseSrcset returns the urls of the image candidates in srcset
+func parseSrcset(srcset string) (urls []string) {
+	for _, c := range strings.Split(srcset, ",") {
+		fields := strings.Fields(c)
+		if len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+
+	return urls
+}
+
+// parseMetaRefresh returns the url from the content of meta refresh, such as "5; url=/next"
+func parseMetaRefresh(content string) (string, bool) {
+	i := strings.Index(strings.ToLower(content), "url=")
+	if i == -1 {
+		return "", false
+	}
+
+	u := strings.Trim(strings.TrimSpace(content[i+len("url="):]), `'"`)
+	return u, u != ""
+}
+
+// cssURLs returns the urls in the url(...) of the css
+func cssURLs(css string) (urls []string) {
+	for _, m := range cssURLRegex.FindAllStringSubmatch(css, -1) {
+		urls = append(urls, m[1])
+	}
+
+	return urls
+}
+
+// PageRelations are the relations a page declares through rel attributes
+type PageRelations struct {
+	Canonical  string            // Canonical is the url of rel=canonical
+	Next       string            // Next is the url of rel=next
+	Prev       string            // Prev is the url of rel=prev
+	Alternates map[string]string // Alternates maps hreflang to the url of rel=alternate
+}
@@ -0,0 +1,151 @@
+package scrape
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+const testLinksHTML = `<html>
+<head>
+<link rel="stylesheet" href="/style.css">
+<meta http-equiv="Refresh" content="5; URL='/next'">
+<meta name="description" content="url=/not-a-link">
+<script src="/app.js"></script>
+<style>body { background: url("/bg.png") } .logo { background: url(/logo.svg) }</style>
+</head>
+<body style="background-image: url('/body.jpg')">
+<a href="/page">Page</a>
+<img src="/img.png" srcset="/img-1x.png 1x, /img-2x.png 2x">
+<map><area href="/area"></map>
+<iframe src="/frame"></iframe>
+<form action="/search"></form>
+<video src="/movie.mp4"><source src="/movie.webm" srcset="/poster.jpg"></video>
+<audio src="/song.mp3"></audio>
+</body>
+</html>`
+
+func Test_extractPageKinds(t *testing.T) {
+	expected := []struct {
+		u    string
+		kind LinkKind
+		tag  string
+		attr string
+	}{
+		{"http://test.com/style.css", LinkHref, "link", "href"},
+		{"http://test.com/next", MetaRefresh, "meta", "content"},
+		{"http://test.com/app.js", ScriptSrc, "script", "src"},
+		{"http://test.com/bg.png", CSSURL, "style", ""},
+		{"http://test.com/logo.svg", CSSURL, "style", ""},
+		{"http://test.com/body.jpg", CSSURL, "body", "style"},
+		{"http://test.com/page", AnchorHref, "a", "href"},
+		{"http://test.com/img.png", ImgSrc, "img", "src"},
+		{"http://test.com/img-1x.png", ImgSrcset, "img", "srcset"},
+		{"http://test.com/img-2x.png", ImgSrcset, "img", "srcset"},
+		{"http://test.com/area", AreaHref, "area", "href"},
+		{"http://test.com/frame", IframeSrc, "iframe", "src"},
+		{"http://test.com/search", FormAction, "form", "action"},
+		{"http://test.com/movie.mp4", VideoSrc, "video", "src"},
+		{"http://test.com/movie.webm", SourceSrc, "source", "src"},
+		{"http://test.com/poster.jpg", SourceSrcset, "source", "srcset"},
+		{"http://test.com/song.mp3", AudioSrc, "audio", "src"},
+	}
+
+	sourceURL, _ := url.Parse("http://test.com")
+	links := extractPage(sourceURL, bytes.NewReader([]byte(testLinksHTML)), nil).links
+	if len(links) != len(expected) {
+		var got []string
+		for _, l := range links {
+			got = append(got, l.url.String())
+		}
+		t.Fatalf("expected %d links but got %d: %v", len(expected), len(links), got)
+	}
+
+	for i, l := range links {
+		e := expected[i]
+		if l.url.String() != e.u || l.kind != e.kind || l.tag != e.tag || l.attr != e.attr {
+			t.Fatalf("expected %+v but got %s %s %s %s", e, l.url, l.kind, l.tag, l.attr)
+		}
+	}
+
+	links = extractPage(sourceURL, bytes.NewReader([]byte(testLinksHTML)), kindsToSet([]LinkKind{ImgSrc, CSSURL})).links
+	if len(links) != 4 {
+		t.Fatalf("expected 4 img and css links but got %d", len(links))
+	}
+}
+
+func Test_parseLinkValues(t *testing.T) {
+	if urls := parseSrcset(" /a.png 1x,/b.png  480w , "); !reflect.DeepEqual(urls, []string{"/a.png", "/b.png"}) {
+		t.Fatalf("unexpected srcset urls: %v", urls)
+	}
+
+	tests := []struct {
+		content string
+		u       string
+		ok      bool
+	}{
+		{content: "0; url=http://test.com/", u: "http://test.com/", ok: true},
+		{content: `3;URL="/next"`, u: "/next", ok: true},
+		{content: "5"},
+	}
+
+	for _, c := range tests {
+		u, ok := parseMetaRefresh(c.content)
+		if u != c.u || ok != c.ok {
+			t.Fatalf("expected %q(%t) for %q but got %q(%t)", c.u, c.ok, c.content, u, ok)
+		}
+	}
+
+	if urls := cssURLs(`a { b: url( "/x.png" ) } c { d: url('/y.png') url(/z.png) }`); !reflect.DeepEqual(urls, []string{"/x.png", "/y.png", "/z.png"}) {
+		t.Fatalf("unexpected css urls: %v", urls)
+	}
+}
+
+func Test_crawlURLFollow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(testLinksHTML))
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	cfg := newCrawlConfig(http.DefaultClient)
+	md := crawlURL(cfg, 0, u)
+	if len(md.links) != 17 || len(md.urls) != 4 {
+		t.Fatalf("expected 17 links and 4 followed urls but got %d and %v", len(md.links), md.urls)
+	}
+
+	cfg.follow = kindsToSet([]LinkKind{ImgSrc})
+	md = crawlURL(cfg, 0, u)
+	if len(md.urls) != 1 || md.urls[0].String() != ts.URL+"/img.png" {
+		t.Fatalf("expected only img to be followed but got %v", md.urls)
+	}
+}
+
+func Test_crawlURLNofollow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<link rel="canonical" href="/"><a href="/1">One</a><a href="/2" rel="nofollow">Two</a>`))
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	cfg := newCrawlConfig(http.DefaultClient)
+	md := crawlURL(cfg, 0, u)
+	if len(md.links) != 3 || len(md.urls) != 1 || md.urls[0].String() != ts.URL+"/1" {
+		t.Fatalf("expected 3 links and only /1 followed but got %d and %v", len(md.links), md.urls)
+	}
+
+	if md.relations == nil || md.relations.Canonical != ts.URL+"/" {
+		t.Fatalf("expected canonical %s but got %+v", ts.URL+"/", md.relations)
+	}
+
+	cfg.followNofollow = true
+	md = crawlURL(cfg, 0, u)
+	if len(md.urls) != 2 {
+		t.Fatalf("expected nofollow link to be followed but got %v", md.urls)
+	}
+}
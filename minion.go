@@ -1,110 +1,223 @@
 package scrape
 
 import (
+	"bytes"
 	"context"
-	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
-	"sync"
+	"time"
 )
 
-// minion crawls the link, scrape urls normalises then and returns the dump to gru
+// defaultMaxBodySize is the max bytes of the page body read
+const defaultMaxBodySize = 10 << 20
+
+// crawlConfig holds the configuration the minions crawl the urls with
+type crawlConfig struct {
+	client  *http.Client      // client used to fetch the urls
+	robots  *robotsCache      // robots.txt rules to honour. nil means robots.txt is ignored
+	extract map[LinkKind]bool // extract holds the kinds of links extracted from the page. nil extracts all
+	follow  map[LinkKind]bool // follow holds the kinds of links followed. rest are only recorded
+
+	normalizer   Normalizer     // normalizer applied to the extracted urls. nil leaves them as is
+	domainRegex  *regexp.Regexp // domainRegex the redirect targets must match. nil allows all
+	maxRedirects int            // maxRedirects is the max redirect hops followed for a single url
+	maxBodySize  int64          // maxBodySize is the max bytes of the body read
+	discardBody  bool           // discardBody drops the body once the links are extracted
+	rules        []*RuleSet     // rules extracting the records from the pages
+	urlRules     []*URLRule     // urlRules the redirect targets must be allowed by
+
+	// followNofollow follows the links marked rel=nofollow or on pages with meta robots nofollow
+	followNofollow bool
+}
+
+// newCrawlConfig returns a crawl config that extracts all links and follows the default kinds
+func newCrawlConfig(client *http.Client) *crawlConfig {
+	return &crawlConfig{
+		client:       client,
+		follow:       kindsToSet(DefaultFollowKinds),
+		maxRedirects: defaultMaxRedirects,
+		maxBodySize:  defaultMaxBodySize,
+	}
+}
+
+// minion pulls the urls from the gru one at a time, crawls them and returns the dump to gru
 type minion struct {
 	name      string
-	busy      bool                // busy represents whether minion is idle/busy
-	mu        *sync.RWMutex       // protects the above
-	payloadCh chan *minionPayload // payload listens for urls to be scrapped
-	gruDumpCh chan<- *minionDumps // gruDumpCh to send finished data to gru
+	cfg       *crawlConfig          // cfg the urls are crawled with
+	payloadCh <-chan *minionPayload // payloadCh is the queue shared by all the minions to pull the urls from
+	gruDumpCh chan<- *minionDumps   // gruDumpCh to send finished data to gru
+	quit      chan struct{}         // quit is closed when gru lets go of the minion
 }
 
-// newMinion returns a new minion under given gru
-func newMinion(name string, gruDumpCh chan<- *minionDumps) *minion {
+// newMinion returns a new minion pulling the urls from the payloadCh
+func newMinion(name string, cfg *crawlConfig, payloadCh <-chan *minionPayload, gruDumpCh chan<- *minionDumps) *minion {
 	return &minion{
 		name:      name,
-		mu:        &sync.RWMutex{},
-		payloadCh: make(chan *minionPayload),
+		cfg:       cfg,
+		payloadCh: payloadCh,
 		gruDumpCh: gruDumpCh,
+		quit:      make(chan struct{}),
 	}
 }
 
-// isBusy says if the minion is busy or idle
-func isBusy(m *minion) bool {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// crawlURL crawls the url and extracts the urls from the page
+func crawlURL(cfg *crawlConfig, depth int, u *url.URL) (md *minionDump) {
+	resp, redirects, err := fetchURL(cfg, u)
+	md = &minionDump{
+		depth:     depth + 1,
+		sourceURL: u,
+		redirects: redirects,
+	}
 
-	return m.busy
-}
+	if len(redirects) > 0 {
+		md.finalURL, _ = url.Parse(redirects[len(redirects)-1].To)
+	}
 
-// crawlURL crawls the url and extracts the urls from the page
-func crawlURL(depth int, u *url.URL) (md *minionDump) {
-	resp, err := http.DefaultClient.Get(u.String())
-	if err != nil {
-		return &minionDump{
-			depth:     depth + 1,
-			sourceURL: u,
-			err:       err,
+	switch err.(type) {
+	case nil:
+	case *RedirectLoopError, *TooManyRedirectsError:
+		md.err = err
+		return md
+	case *blockedRedirectError:
+		md.blocked = err.(*blockedRedirectError)
+		return md
+	default:
+		if err == errOffDomainRedirect {
+			md.offDomain = true
+			return md
 		}
+
+		md.err = &FetchError{URL: u.String(), Err: err}
+		md.transient = isTransientErr(err)
+		return md
 	}
 
 	defer resp.Body.Close()
 
+	// links are resolved against the final url the page is served from
+	final := u
+	if md.finalURL != nil {
+		final = md.finalURL
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return &minionDump{
-			depth:     depth + 1,
-			sourceURL: u,
-			err:       fmt.Errorf("url responsed with code %d", resp.StatusCode),
-		}
+		md.err = &HTTPStatusError{URL: final.String(), Code: resp.StatusCode}
+		md.transient = isTransientStatus(resp.StatusCode)
+		md.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		return md
 	}
 
 	ct := resp.Header.Get("Content-type")
 	if ct != "" && !strings.Contains(ct, "text/html") {
-		return &minionDump{
-			depth:     depth + 1,
-			sourceURL: u,
-			err:       fmt.Errorf("unknown content type: %s", ct),
-		}
+		md.err = &ContentTypeError{URL: final.String(), ContentType: ct}
+		return md
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, cfg.maxBodySize+1))
+	if err != nil {
+		md.err = &FetchError{URL: final.String(), Err: err}
+		md.transient = isTransientErr(err)
+		return md
 	}
 
-	s, iu := extractURLsFromHTML(u, resp.Body)
-	return &minionDump{
-		depth:       depth + 1,
-		sourceURL:   u,
-		urls:        s,
-		invalidURLs: iu,
+	md.page = &Page{
+		URL:         u.String(),
+		FinalURL:    final.String(),
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header,
+		ContentType: ct,
 	}
+
+	if int64(len(body)) > cfg.maxBodySize {
+		body = body[:cfg.maxBodySize]
+		md.page.Truncated = true
+	}
+
+	if len(cfg.rules) > 0 {
+		md.page.Record = extractRecord(cfg.rules, final.String(), body)
+	}
+
+	if !cfg.discardBody {
+		md.page.Body = body
+	}
+
+	page := extractPage(final, bytes.NewReader(body), cfg.extract)
+	for _, l := range page.links {
+		if cfg.normalizer != nil {
+			l.url = cfg.normalizer.Normalize(l.url)
+		}
+
+		if cfg.follow[l.kind] && (!l.nofollow || cfg.followNofollow) {
+			md.urls = append(md.urls, l.url)
+		}
+	}
+
+	md.links = page.links
+	md.invalidURLs = page.invalidURLs
+	md.relations = page.relations
+	md.noindex = page.noindex || robotsNoindex(resp.Header["X-Robots-Tag"])
+	return md
 }
 
-// crawlURLs crawls given urls and return extracted url from the page
-func crawlURLs(depth int, urls []*url.URL) (mds []*minionDump) {
-	for _, u := range urls {
-		mds = append(mds, crawlURL(depth, u))
+// crawlPayload crawls the url of the payload honouring robots.txt and returns the dump.
+// url is only checked and not crawled if the payload says so
+func crawlPayload(m *minion, mp *minionPayload) *minionDump {
+	depth, u := mp.currentDepth, mp.url
+	if m.cfg.robots != nil {
+		if ok, rule := allowedByRobots(m.cfg.robots, u); !ok {
+			return &minionDump{
+				depth:        depth + 1,
+				sourceURL:    u,
+				disallowedBy: rule,
+			}
+		}
+
+		waitForCrawlDelay(m.cfg.robots, u)
+	}
+
+	if mp.check {
+		return checkURL(m.cfg.client, depth, u)
 	}
 
-	return mds
+	st := time.Now()
+	md := crawlURL(m.cfg, depth, u)
+	md.latency = time.Since(st)
+	return md
 }
 
-// startMinion starts the minion
+// startMinion starts the minion. minion pulls the next url only once the previous one is dumped
+// so that an idle minion always picks up the work left by a slow one
 func startMinion(ctx context.Context, m *minion) {
 	log.Printf("Starting %s...\n", m.name)
 
 	for {
+		// quit is checked first so that a stopped minion doesn't pull any more urls
+		select {
+		case <-m.quit:
+			log.Printf("Stopping %s...\n", m.name)
+			return
+		default:
+		}
+
 		select {
 		case <-ctx.Done():
 			return
+		case <-m.quit:
+			log.Printf("Stopping %s...\n", m.name)
+			return
 		case mp := <-m.payloadCh:
-			m.busy = true
-			log.Printf("Crawling urls(%d) from depth %d\n", len(mp.urls), mp.currentDepth)
-			mds := crawlURLs(mp.currentDepth, mp.urls)
-			got := make(chan bool)
-			m.gruDumpCh <- &minionDumps{
-				minion: m.name,
-				got:    got,
-				mds:    mds,
+			log.Printf("%s crawling %s from depth %d\n", m.name, mp.url, mp.currentDepth)
+			md := crawlPayload(m, mp)
+			select {
+			case <-ctx.Done():
+				return
+			case m.gruDumpCh <- &minionDumps{minion: m, mds: []*minionDump{md}}:
 			}
-			<-got
-			m.busy = false
 		}
 	}
 }
@@ -1,6 +1,10 @@
 package scrape
 
 import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 )
@@ -25,7 +29,7 @@ func Test_crawlURL(t *testing.T) {
 
 	for _, c := range tests {
 		u, _ := url.Parse(c.u)
-		md := crawlURL(c.depth, u)
+		md := crawlURL(newCrawlConfig(http.DefaultClient), c.depth, u)
 		if md.err != nil && !c.error {
 			t.Fatalf("failed to crawl %s\n", u.String())
 		}
@@ -39,3 +43,89 @@ func Test_crawlURL(t *testing.T) {
 		}
 	}
 }
+
+func Test_crawlURLErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	u, _ := url.Parse(ts.URL + "/missing")
+	md := crawlURL(newCrawlConfig(http.DefaultClient), 0, u)
+	var se *HTTPStatusError
+	if !errors.As(md.err, &se) || se.Code != http.StatusNotFound || se.URL != u.String() {
+		t.Fatalf("expected status error with 404 but got %v", md.err)
+	}
+
+	u, _ = url.Parse(ts.URL + "/image")
+	md = crawlURL(newCrawlConfig(http.DefaultClient), 0, u)
+	var ce *ContentTypeError
+	if !errors.As(md.err, &ce) || ce.ContentType != "image/png" {
+		t.Fatalf("expected content type error but got %v", md.err)
+	}
+
+	u, _ = url.Parse(closed.URL)
+	md = crawlURL(newCrawlConfig(http.DefaultClient), 0, u)
+	var fe *FetchError
+	var oe *net.OpError
+	if !errors.As(md.err, &fe) || !errors.As(md.err, &oe) {
+		t.Fatalf("expected fetch error wrapping net error but got %v", md.err)
+	}
+}
+
+func Test_crawlURLPage(t *testing.T) {
+	body := `<title>Test</title><a href="/1">1</a><a href="/2">2</a>`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Test", "yes")
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		maxBodySize int64
+		discard     bool
+		body        string
+		truncated   bool
+		links       int
+	}{
+		{maxBodySize: defaultMaxBodySize, body: body, links: 2},
+		{maxBodySize: int64(len(body)), body: body, links: 2},
+		{maxBodySize: 40, body: body[:40], truncated: true, links: 1},
+		{maxBodySize: defaultMaxBodySize, discard: true, links: 2},
+	}
+
+	u, _ := url.Parse(ts.URL + "/old")
+	for _, c := range tests {
+		cfg := newCrawlConfig(http.DefaultClient)
+		cfg.maxBodySize = c.maxBodySize
+		cfg.discardBody = c.discard
+		md := crawlURL(cfg, 0, u)
+		p := md.page
+		if p == nil {
+			t.Fatalf("expected page but got none: %v", md.err)
+		}
+
+		if p.URL != u.String() || p.FinalURL != ts.URL+"/" || p.StatusCode != http.StatusOK ||
+			p.ContentType != "text/html; charset=utf-8" || p.Header.Get("X-Test") != "yes" {
+			t.Fatalf("unexpected page: %+v", p)
+		}
+
+		if string(p.Body) != c.body || p.Truncated != c.truncated || len(md.links) != c.links {
+			t.Fatalf("expected body %q truncated(%t) with %d links but got %q %t %d", c.body, c.truncated, c.links, p.Body, p.Truncated, len(md.links))
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package scrape
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Normalizer normalizes the urls before they are deduped and crawled
+type Normalizer interface {
+	Normalize(u *url.URL) *url.URL
+}
+
+// NormalizerFunc is an adapter to use functions as Normalizer
+type NormalizerFunc func(u *url.URL) *url.URL
+
+// Normalize calls f(u)
+func (f NormalizerFunc) Normalize(u *url.URL) *url.URL {
+	return f(u)
+}
+
+// DefaultTrackingParams are the query params stripped by the DefaultNormalizer.
+// Params ending with * match by prefix
+var DefaultTrackingParams = []string{"utm_*", "fbclid", "gclid", "msclkid"}
+
+// URLNormalizer lowercases the scheme and host, converts the host to punycode, drops the default ports,
+// resolves the dot segments and removes the fragment. Rest of the steps are configurable
+type URLNormalizer struct {
+	StripParams       []string // StripParams are removed from the query. Params ending with * match by prefix
+	SortQuery         bool     // SortQuery sorts the query params by key
+	FoldTrailingSlash bool     // FoldTrailingSlash removes the trailing slash from the paths other than root
+}
+
+// DefaultNormalizer sorts the query and strips the tracking params
+var DefaultNormalizer = &URLNormalizer{StripParams: DefaultTrackingParams, SortQuery: true}
+
+// defaultPorts maps the scheme to its default port
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Normalize returns the normalized copy of the url
+func (n *URLNormalizer) Normalize(u *url.URL) *url.URL {
+	nu := *u
+	nu.Scheme = strings.ToLower(nu.Scheme)
+	nu.Fragment, nu.RawFragment = "", ""
+
+	host, port := strings.ToLower(nu.Hostname()), nu.Port()
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	}
+
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	if port != "" && port != defaultPorts[nu.Scheme] {
+		host += ":" + port
+	}
+	nu.Host = host
+
+	// path is cleaned escaped so that escapes such as %2F are not decoded into a different path
+	escaped := normalizePath(nu.EscapedPath(), n.FoldTrailingSlash)
+	if p, err := url.PathUnescape(escaped); err == nil {
+		nu.Path, nu.RawPath = p, escaped
+	}
+	if nu.RawQuery != "" {
+		nu.RawQuery = normalizeQuery(nu.RawQuery, n.StripParams, n.SortQuery)
+	}
+
+	return &nu
+}
+
+// normalizePath resolves the dot segments in the escaped path and optionally folds the trailing slash.
+// empty segments are kept as servers may tell a//b apart from a/b
+func normalizePath(p string, foldSlash bool) string {
+	if p == "" {
+		return "/"
+	}
+
+	segments := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	var out []string
+	for i, seg := range segments {
+		switch seg {
+		case ".":
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, seg)
+			continue
+		}
+
+		// dot segment at the end leaves the path with a trailing slash
+		if i == len(segments)-1 {
+			out = append(out, "")
+		}
+	}
+
+	p = "/" + strings.Join(out, "/")
+	if foldSlash && p != "/" {
+		p = strings.TrimSuffix(p, "/")
+	}
+
+	return p
+}
+
+// normalizeQuery strips the params matching strip and sorts the rest if asked
+func normalizeQuery(rawQuery string, strip []string, sortQuery bool) string {
+	var params, keys []string
+	for _, p := range strings.Split(rawQuery, "&") {
+		if p == "" {
+			continue
+		}
+
+		key := p
+		if i := strings.Index(p, "="); i != -1 {
+			key = p[:i]
+		}
+
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+
+		if !matchParam(strip, key) {
+			params, keys = append(params, p), append(keys, key)
+		}
+	}
+
+	if sortQuery {
+		// stable so that the values of repeated params keep their order
+		sort.Stable(byKey{params, keys})
+	}
+
+	return strings.Join(params, "&")
+}
+
+// byKey sorts the params by their keys
+type byKey struct {
+	params, keys []string
+}
+
+func (b byKey) Len() int           { return len(b.params) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.params[i], b.params[j] = b.params[j], b.params[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+// matchParam says if the key matches any of the params. params ending with * match by prefix
+func matchParam(params []string, key string) bool {
+	for _, p := range params {
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(key, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+
+		if p == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeURLs normalizes the urls in place with given normalizer. nil normalizer leaves them as is
+func normalizeURLs(n Normalizer, urls []*url.URL) {
+	if n == nil {
+		return
+	}
+
+	for i, u := range urls {
+		urls[i] = n.Normalize(u)
+	}
+}
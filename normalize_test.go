@@ -0,0 +1,125 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestURLNormalizer_Normalize(t *testing.T) {
+	tests := []struct {
+		normalizer *URLNormalizer
+		url        string
+		expected   string
+	}{
+		{
+			normalizer: DefaultNormalizer,
+			url:        "HTTP://Example.com:80/a/../b?utm_source=x",
+			expected:   "http://example.com/b",
+		},
+
+		{
+			normalizer: DefaultNormalizer,
+			url:        "https://example.com:443",
+			expected:   "https://example.com/",
+		},
+
+		{
+			normalizer: DefaultNormalizer,
+			url:        "http://example.com:8080/a/./b/#top",
+			expected:   "http://example.com:8080/a/b/",
+		},
+
+		{
+			normalizer: DefaultNormalizer,
+			url:        "http://example.com/?b=2&fbclid=x&a=1&b=1&utm_medium=y",
+			expected:   "http://example.com/?a=1&b=2&b=1",
+		},
+
+		{
+			normalizer: DefaultNormalizer,
+			url:        "http://Bücher.example/",
+			expected:   "http://xn--bcher-kva.example/",
+		},
+
+		{
+			normalizer: &URLNormalizer{FoldTrailingSlash: true},
+			url:        "http://example.com/a/?utm_source=x&b=2&a=1",
+			expected:   "http://example.com/a?utm_source=x&b=2&a=1",
+		},
+
+		{
+			normalizer: &URLNormalizer{FoldTrailingSlash: true},
+			url:        "http://example.com/",
+			expected:   "http://example.com/",
+		},
+
+		// escapes and empty segments point to different resources
+		{
+			normalizer: DefaultNormalizer,
+			url:        "http://example.com/files/a%2Fb/./c/../d",
+			expected:   "http://example.com/files/a%2Fb/d",
+		},
+
+		{
+			normalizer: DefaultNormalizer,
+			url:        "http://example.com/a//b/..",
+			expected:   "http://example.com/a//",
+		},
+
+		{
+			normalizer: &URLNormalizer{StripParams: []string{"session"}},
+			url:        "http://[::1]:80/a?session=1",
+			expected:   "http://[::1]/a",
+		},
+	}
+
+	for _, c := range tests {
+		u, _ := url.Parse(c.url)
+		r := c.normalizer.Normalize(u).String()
+		if r != c.expected {
+			t.Fatalf("expected %s but got %s", c.expected, r)
+		}
+	}
+}
+
+func TestCrawler_RunPathSensitive(t *testing.T) {
+	// server tells apart the escaped slash and the empty segment from the plain paths
+	var mu sync.Mutex
+	var requested []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.EscapedPath())
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.EscapedPath() {
+		case "/":
+			fmt.Fprint(w, `<a href="/files/a%2Fb">escaped</a><a href="/x//y">empty segment</a>`)
+		case "/files/a%2Fb", "/x//y":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	resp, err := New(WithIgnoreRobots(true)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sort.Strings(requested)
+	expected := []string{"/", "/files/a%2Fb", "/x//y"}
+	if fmt.Sprint(requested) != fmt.Sprint(expected) || len(resp.ErrorURLs) != 0 {
+		t.Fatalf("expected %v to be requested but got %v with errors %v", expected, requested, resp.ErrorURLs)
+	}
+
+	if _, ok := resp.UniqueURLs[ts.URL+"/files/a%2Fb"]; !ok {
+		t.Fatalf("expected escaped url to be recorded as found: %v", resp.UniqueURLs)
+	}
+}
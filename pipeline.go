@@ -0,0 +1,174 @@
+package scrape
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Stage names a built-in processor of the crawl pipeline
+type Stage string
+
+// Built-in stages in the order they are run
+const (
+	StageRobots       Stage = "robots"        // records the allowed urls per depth and the urls disallowed by robots.txt
+	StageLinkCheck    Stage = "link-check"    // records the results of the checked urls
+	StageRedirect     Stage = "redirect"      // records redirects and dedupes on the final url
+	StageURLFilter    Stage = "url-filter"    // removes the urls excluded by the url rules
+	StageLinkGraph    Stage = "link-graph"    // records the links found in the page
+	StageRelations    Stage = "relations"     // records the relations declared by the page
+	StageRecords      Stage = "records"       // records the fields extracted by the rules
+	StageUnique       Stage = "unique"        // removes the urls already crawled
+	StageError        Stage = "error"         // records the urls failed to crawl
+	StagePage         Stage = "page"          // records the page and calls the OnPage hook
+	StageSkipped      Stage = "skipped"       // records the invalid urls
+	StageMaxDepth     Stage = "max-depth"     // stops following urls at max depth
+	StageDomainFilter Stage = "domain-filter" // removes the urls failing domainRegex
+	StageLimits       Stage = "limits"        // removes the urls breaking the limits
+)
+
+// stage is a built-in processor along with its name
+type stage struct {
+	name Stage
+	p    processor
+}
+
+// builtinStages returns the built-in processors in the order they are run
+func builtinStages() []stage {
+	return []stage{
+		{StageRobots, robotsProcessor()},
+		{StageLinkCheck, linkCheckProcessor()},
+		{StageRedirect, redirectProcessor()},
+		{StageURLFilter, urlFilterProcessor()},
+		{StageLinkGraph, linkGraphProcessor()},
+		{StageRelations, pageRelationsProcessor()},
+		{StageRecords, recordProcessor()},
+		{StageUnique, uniqueURLProcessor()},
+		{StageError, errorCheckProcessor()},
+		{StagePage, pageProcessor()},
+		{StageSkipped, skippedURLProcessor()},
+		{StageMaxDepth, maxDepthCheckProcessor()},
+		{StageDomainFilter, domainFilterProcessor()},
+		{StageLimits, limitsProcessor()},
+	}
+}
+
+// Dump is the result of crawling a single url passed through the processors
+type Dump struct {
+	URL   string     // URL crawled. final url if redirected
+	Depth int        // Depth the URL is found at
+	Page  *Page      // Page crawled. nil if the url failed, is checked or disallowed
+	URLs  []*url.URL // URLs followed from the page. processors can remove or add urls
+	Err   error      // Err is the reason the url failed to crawl
+	Check *LinkCheck // Check holds the result if the url is checked and not crawled
+}
+
+// Crawl is the restricted handle on the crawl state given to the processors
+type Crawl struct {
+	g *gru
+}
+
+// BaseURL returns the url the crawl started from
+func (c *Crawl) BaseURL() *url.URL {
+	return c.g.baseURL
+}
+
+// Crawled says if the url is already crawled
+func (c *Crawl) Crawled(u string) bool {
+	_, ok := c.g.scrappedUnique[u]
+	return ok
+}
+
+// Enqueue queues the urls to be crawled at given depth, bypassing the domain filter.
+// urls already crawled, being crawled, waiting to be retried or disallowed are ignored
+func (c *Crawl) Enqueue(depth int, urls ...*url.URL) {
+	normalizeURLs(c.g.normalizer, urls)
+	for _, u := range urls {
+		if _, ok := c.g.disallowedURLs[u.String()]; ok || c.Crawled(u.String()) {
+			continue
+		}
+
+		if _, ok := c.g.inFlight[u.String()]; ok || retrying(c.g, u.String()) {
+			continue
+		}
+
+		pushURLs(c.g.unScrapped, depth, "", u)
+	}
+}
+
+// Inlinks returns the number of links found to the url so far
+func (c *Crawl) Inlinks(u string) int {
+	return c.g.inlinks[u]
+}
+
+// Mark adds the marks to the url. marks are returned in Response.Marks
+func (c *Crawl) Mark(u string, marks ...string) {
+	c.g.marks[u] = append(c.g.marks[u], marks...)
+}
+
+// Processor is a custom stage of the crawl pipeline run on every dump
+type Processor interface {
+	Process(c *Crawl, d *Dump) (proceed bool)
+}
+
+// ProcessorFunc defines the processor func type
+type ProcessorFunc func(c *Crawl, d *Dump) (proceed bool)
+
+// Process acts a proxy to underlying processor
+func (pf ProcessorFunc) Process(c *Crawl, d *Dump) (proceed bool) {
+	return pf(c, d)
+}
+
+// userProcessor adapts the Processor to the internal processor
+func userProcessor(p Processor) processor {
+	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
+		d := &Dump{
+			URL:   md.sourceURL.String(),
+			Depth: md.depth - 1,
+			URLs:  md.urls,
+			Err:   md.err,
+			Check: md.check,
+		}
+
+		if md.page != nil && md.err == nil {
+			d.Page = newPage(md)
+		}
+
+		proceed = p.Process(&Crawl{g: g}, d)
+		md.urls = d.URLs
+		return proceed
+	})
+}
+
+// pipeline returns the built-in processors with the custom processors inserted before and after them.
+// custom processors run after the built-ins that stop processing the dump are skipped along with the rest of the pipeline
+func pipeline(before, after map[Stage][]Processor, last []Processor) ([]processor, error) {
+	stages := builtinStages()
+	known := make(map[Stage]bool)
+	for _, s := range stages {
+		known[s.name] = true
+	}
+
+	for _, m := range []map[Stage][]Processor{before, after} {
+		for name := range m {
+			if !known[name] {
+				return nil, fmt.Errorf("unknown stage: %s", name)
+			}
+		}
+	}
+
+	var ps []processor
+	add := func(ups []Processor) {
+		for _, p := range ups {
+			ps = append(ps, userProcessor(p))
+		}
+	}
+
+	for _, s := range stages {
+		add(before[s.name])
+		ps = append(ps, s.p)
+		add(after[s.name])
+	}
+
+	add(last)
+	return ps, nil
+}
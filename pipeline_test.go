@@ -0,0 +1,80 @@
+package scrape
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestCrawler_RunProcessors(t *testing.T) {
+	ts := testServer()
+	defer ts.Close()
+
+	drop := ProcessorFunc(func(c *Crawl, d *Dump) bool {
+		var urls []*url.URL
+		for _, u := range d.URLs {
+			if u.Path != "/2" {
+				urls = append(urls, u)
+			}
+		}
+
+		d.URLs = urls
+		return true
+	})
+
+	var pages []string
+	mark := ProcessorFunc(func(c *Crawl, d *Dump) bool {
+		if d.Page == nil {
+			return true
+		}
+
+		pages = append(pages, d.Page.FinalURL)
+		c.Mark(d.URL, "seen")
+		return true
+	})
+
+	enqueue := ProcessorFunc(func(c *Crawl, d *Dump) bool {
+		if d.URL == ts.URL+"/3" {
+			u, _ := url.Parse(ts.URL + "/2")
+			c.Enqueue(d.Depth+1, u)
+		}
+
+		return true
+	})
+
+	resp, err := New(
+		WithIgnoreRobots(true),
+		WithProcessorsBefore(StageUnique, drop),
+		WithProcessorsAfter(StagePage, mark),
+		WithProcessors(enqueue),
+	).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(resp.UniqueURLs) != 4 || len(pages) != 4 || len(resp.Marks) != 4 {
+		t.Fatalf("expected 4 pages crawled and marked but got %v %v %v", resp.UniqueURLs, pages, resp.Marks)
+	}
+
+	if m := resp.Marks[ts.URL+"/2"]; len(m) != 1 || m[0] != "seen" {
+		t.Fatalf("expected enqueued url to be crawled and marked but got %v", resp.Marks)
+	}
+
+	// /2 is only reachable through the enqueue from /3
+	if resp.URLsPerDepth[3] == nil || resp.URLsPerDepth[3][0].String() != ts.URL+"/2" {
+		t.Fatalf("expected /2 to be crawled at depth 3 but got %v", resp.URLsPerDepth)
+	}
+}
+
+func Test_pipeline(t *testing.T) {
+	p := ProcessorFunc(func(c *Crawl, d *Dump) bool { return true })
+	ps, err := pipeline(map[Stage][]Processor{StageRobots: {p}}, map[Stage][]Processor{StageDomainFilter: {p, p}}, []Processor{p})
+	if err != nil || len(ps) != len(builtinStages())+4 {
+		t.Fatalf("expected %d processors but got %d: %v", len(builtinStages())+4, len(ps), err)
+	}
+
+	_, err = pipeline(map[Stage][]Processor{"unknown": {p}}, nil, nil)
+	if err == nil {
+		t.Fatal("expected error for unknown stage")
+	}
+}
@@ -0,0 +1,113 @@
+package scrape
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// latencyDegradeFactor is how much the latency can grow over the base latency
+// before the pool starts letting go of minions
+const latencyDegradeFactor = 2
+
+// baseLatencyWindow is the number of dumps over which the base latency drifts up to the latency,
+// so that a slow period doesn't keep the pool shrinking for the rest of the crawl
+const baseLatencyWindow = 20
+
+// minionPool grows and shrinks the minions of gru at runtime based on
+// the queue length and observed crawl latency
+type minionPool struct {
+	min         int                       // min number of minions to keep
+	max         int                       // max number of minions to spawn
+	latency     time.Duration             // latency is the moving average of crawl latency
+	baseLatency time.Duration             // baseLatency is the slow moving average of the latency, reset to the latency when the pool grows
+	spawn       func(name string) *minion // spawn creates and starts a new minion
+	spawned     int                       // spawned is the total minions spawned so far
+}
+
+// newMinionPool returns a new pool that keeps minions between min and max
+func newMinionPool(min, max int, spawn func(name string) *minion) *minionPool {
+	return &minionPool{
+		min:   min,
+		max:   max,
+		spawn: spawn,
+	}
+}
+
+// observeLatency updates the moving average of the latency from the dumps.
+// dumps that made no request, such as the ones disallowed by robots.txt, are ignored
+func observeLatency(p *minionPool, mds []*minionDump) {
+	for _, md := range mds {
+		if md.latency == 0 || md.disallowedBy != "" {
+			continue
+		}
+
+		if p.latency == 0 {
+			p.latency = md.latency
+		} else {
+			p.latency = (p.latency*4 + md.latency) / 5
+		}
+
+		if p.baseLatency == 0 || p.latency < p.baseLatency {
+			p.baseLatency = p.latency
+			continue
+		}
+
+		p.baseLatency = (p.baseLatency*(baseLatencyWindow-1) + p.latency) / baseLatencyWindow
+	}
+}
+
+// minionName returns the name of i'th minion
+func minionName(i int) string {
+	return fmt.Sprintf("Minion %d", i)
+}
+
+// spawnMinions adds n new minions to gru
+func spawnMinions(g *gru, n int) {
+	for i := 0; i < n; i++ {
+		m := g.pool.spawn(minionName(g.pool.spawned))
+		g.pool.spawned++
+		g.minions = append(g.minions, m)
+	}
+}
+
+// stopMinions lets go of n minions. minions stop pulling the urls once they are done with their current url
+func stopMinions(g *gru, n int) {
+	last := len(g.minions) - n
+	for _, m := range g.minions[last:] {
+		close(m.quit)
+	}
+
+	g.minions = g.minions[:last]
+}
+
+// scalePool grows the pool when the queue outgrows the idle minions and shrinks it
+// when there are more idle minions than the queue or the latency has degraded
+func scalePool(g *gru) {
+	p := g.pool
+	queued := g.unScrapped.Len() + g.unChecked.Len()
+
+	idle := idleMinions(g)
+	switch {
+	case p.latency > p.baseLatency*latencyDegradeFactor && len(g.minions) > p.min && idle > 0:
+		log.Printf("latency degraded to %v from %v. stopping a minion...\n", p.latency, p.baseLatency)
+		stopMinions(g, 1)
+	case queued > idle && len(g.minions) < p.max:
+		n := queued - idle
+		if n > p.max-len(g.minions) {
+			n = p.max - len(g.minions)
+		}
+
+		log.Printf("%d urls queued. spawning %d minions...\n", queued, n)
+		spawnMinions(g, n)
+		p.baseLatency = p.latency
+	case queued < idle && len(g.minions) > p.min:
+		n := idle - queued
+		if n > len(g.minions)-p.min {
+			n = len(g.minions) - p.min
+		}
+
+		log.Printf("%d urls queued. stopping %d idle minions...\n", queued, n)
+		stopMinions(g, n)
+	}
+}
@@ -0,0 +1,162 @@
+package scrape
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func Test_scalePool(t *testing.T) {
+	tests := []struct {
+		minions  int
+		busy     int
+		queued   int
+		checks   int
+		min      int
+		max      int
+		latency  time.Duration
+		expected int
+	}{
+		// grow to match the queue
+		{
+			minions:  2,
+			busy:     2,
+			queued:   3,
+			min:      1,
+			max:      10,
+			expected: 5,
+		},
+
+		// grow till max
+		{
+			minions:  2,
+			queued:   20,
+			min:      1,
+			max:      10,
+			expected: 10,
+		},
+
+		// grow to match the urls queued for checking
+		{
+			minions:  1,
+			busy:     1,
+			checks:   3,
+			min:      1,
+			max:      10,
+			expected: 4,
+		},
+
+		// shrink idle minions
+		{
+			minions:  6,
+			busy:     2,
+			queued:   1,
+			min:      1,
+			max:      10,
+			expected: 3,
+		},
+
+		// shrink till min
+		{
+			minions:  6,
+			min:      4,
+			max:      10,
+			expected: 4,
+		},
+
+		// latency degraded
+		{
+			minions:  4,
+			busy:     2,
+			queued:   10,
+			min:      1,
+			max:      10,
+			latency:  time.Second,
+			expected: 3,
+		},
+	}
+
+	for _, c := range tests {
+		baseURL, _ := url.Parse("http://test.com")
+		g := newGru(baseURL, -1)
+		g.pool = newMinionPool(c.min, c.max, func(name string) *minion {
+			return newMinion(name, newCrawlConfig(http.DefaultClient), g.payloadCh, g.submitDumpCh)
+		})
+		g.pool.baseLatency = 100 * time.Millisecond
+		g.pool.latency = 100 * time.Millisecond
+		if c.latency > 0 {
+			g.pool.latency = c.latency
+		}
+
+		spawnMinions(g, c.minions)
+		for i := 0; i < c.busy; i++ {
+			g.inFlight[fmt.Sprintf("http://test.com/busy/%d", i)] = inFlightURL{depth: 1}
+		}
+
+		for i := 0; i < c.queued; i++ {
+			u, _ := url.Parse(fmt.Sprintf("http://test.com/%d", i))
+			pushURLs(g.unScrapped, 1, "", u)
+		}
+
+		for i := 0; i < c.checks; i++ {
+			u, _ := url.Parse(fmt.Sprintf("http://github.com/%d", i))
+			pushURLs(g.unChecked, 1, "", u)
+		}
+
+		scalePool(g)
+		if len(g.minions) != c.expected {
+			t.Fatalf("expected %d minions but got %d", c.expected, len(g.minions))
+		}
+	}
+}
+
+func Test_observeLatency(t *testing.T) {
+	p := newMinionPool(1, 2, nil)
+	observeLatency(p, []*minionDump{{latency: 100 * time.Millisecond}})
+	if p.latency != 100*time.Millisecond || p.baseLatency != 100*time.Millisecond {
+		t.Fatalf("unexpected latency %v and base latency %v", p.latency, p.baseLatency)
+	}
+
+	observeLatency(p, []*minionDump{{latency: 600 * time.Millisecond}})
+	if p.latency != 200*time.Millisecond || p.baseLatency != 105*time.Millisecond {
+		t.Fatalf("unexpected latency %v and base latency %v", p.latency, p.baseLatency)
+	}
+
+	// dumps that made no request are ignored
+	observeLatency(p, []*minionDump{{disallowedBy: "Disallow: /"}, {latency: time.Millisecond, disallowedBy: "Disallow: /"}})
+	if p.latency != 200*time.Millisecond || p.baseLatency != 105*time.Millisecond {
+		t.Fatalf("unexpected latency %v and base latency %v", p.latency, p.baseLatency)
+	}
+
+	// base latency catches up with a lasting slowdown
+	for i := 0; i < 100; i++ {
+		observeLatency(p, []*minionDump{{latency: time.Second}})
+	}
+
+	if p.baseLatency*latencyDegradeFactor < p.latency {
+		t.Fatalf("expected base latency %v to catch up with latency %v", p.baseLatency, p.latency)
+	}
+}
+
+func Test_scalePoolResetsBaseLatency(t *testing.T) {
+	baseURL, _ := url.Parse("http://test.com")
+	g := newGru(baseURL, -1)
+	g.pool = newMinionPool(1, 4, func(name string) *minion {
+		return newMinion(name, newCrawlConfig(http.DefaultClient), g.payloadCh, g.submitDumpCh)
+	})
+	g.pool.baseLatency = 100 * time.Millisecond
+	g.pool.latency = 150 * time.Millisecond
+	spawnMinions(g, 1)
+	g.inFlight["http://test.com/busy"] = inFlightURL{depth: 1}
+	for i := 0; i < 3; i++ {
+		u, _ := url.Parse(fmt.Sprintf("http://test.com/%d", i))
+		pushURLs(g.unScrapped, 1, "", u)
+	}
+
+	scalePool(g)
+	if len(g.minions) != 4 || g.pool.baseLatency != g.pool.latency {
+		t.Fatalf("expected 4 minions and base latency reset but got %d and %v", len(g.minions), g.pool.baseLatency)
+	}
+}
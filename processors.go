@@ -1,6 +1,9 @@
 package scrape
 
-import "net/url"
+import (
+	"net/http"
+	"net/url"
+)
 
 // processor defines minionDump process
 type processor interface {
@@ -15,13 +18,225 @@ func (pf processorFunc) process(g *gru, md *minionDump) (proceed bool) {
 	return pf(g, md)
 }
 
+// robotsProcessor records the source url at its depth if robots.txt allowed crawling it, or as disallowed otherwise
+func robotsProcessor() processor {
+	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
+		if md.disallowedBy == "" {
+			g.scrapped[md.depth-1] = append(g.scrapped[md.depth-1], md.sourceURL)
+			return true
+		}
+
+		g.disallowedURLs[md.sourceURL.String()] = md.disallowedBy
+		emitSkip(g, md.sourceURL.String(), []string{md.sourceURL.String()}, SkipDisallowed)
+		return false
+	})
+}
+
+// linkCheckProcessor records the result of the checked source url. Checked urls are not expanded
+func linkCheckProcessor() processor {
+	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
+		if md.check == nil {
+			return true
+		}
+
+		g.checkedURLs[md.sourceURL.String()] = md.check
+		if g.hooks.OnCheck != nil {
+			g.hooks.OnCheck(md.check)
+		}
+
+		return false
+	})
+}
+
+// redirectProcessor records the redirect chain of the source url and moves the dump to the final url,
+// recording the final url at the depth of the source url.
+// dumps redirected to an url already crawled, failing domainRegex, disallowed by robots.txt or
+// excluded by the url rules are not processed further
+func redirectProcessor() processor {
+	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
+		if len(md.redirects) < 1 {
+			return true
+		}
+
+		g.redirects[md.sourceURL.String()] = md.redirects
+		if md.err != nil {
+			return true
+		}
+
+		final := md.redirects[len(md.redirects)-1].To
+		if md.offDomain {
+			g.skippedURLs[md.sourceURL.String()] = append(g.skippedURLs[md.sourceURL.String()], final)
+			emitSkip(g, md.sourceURL.String(), []string{final}, SkipDomain)
+			if g.checkLinks {
+				queueChecks(g, md.depth, md.sourceURL.String(), []*url.URL{md.finalURL})
+			}
+
+			return false
+		}
+
+		if b := md.blocked; b != nil {
+			source := md.sourceURL.String()
+			if b.disallowedBy != "" {
+				g.disallowedURLs[final] = b.disallowedBy
+				emitSkip(g, source, []string{final}, SkipDisallowed)
+				return false
+			}
+
+			g.filteredURLs[final] = b.filteredBy
+			g.skippedURLs[source] = append(g.skippedURLs[source], final)
+			emitSkip(g, source, []string{final}, SkipFiltered)
+			return false
+		}
+
+		if _, ok := g.scrappedUnique[final]; ok {
+			g.scrappedUnique[final]++
+			return false
+		}
+
+		if _, ok := g.inFlight[final]; ok {
+			// being crawled already
+			return false
+		}
+
+		if _, ok := g.unScrapped.queued[final]; ok {
+			// will be crawled when dequeued
+			return false
+		}
+
+		if retrying(g, final) {
+			// will be crawled again after the backoff
+			return false
+		}
+
+		md.sourceURL = md.finalURL
+		g.scrapped[md.depth-1] = append(g.scrapped[md.depth-1], md.sourceURL)
+		return true
+	})
+}
+
+// urlFilterProcessor removes the links and urls excluded by the url rules so that they are neither recorded nor followed.
+// filtered urls are recorded along with the rule filtering them
+func urlFilterProcessor() processor {
+	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
+		if len(g.urlRules) < 1 {
+			return true
+		}
+
+		source := md.sourceURL.String()
+		decided := make(map[string]bool)
+		var filtered []string
+		allowed := func(u *url.URL) bool {
+			us := u.String()
+			if ok, seen := decided[us]; seen {
+				return ok
+			}
+
+			ok, rule := filterURL(g.urlRules, u)
+			decided[us] = ok
+			if !ok {
+				g.filteredURLs[us] = filterReason(rule)
+				filtered = append(filtered, us)
+			}
+
+			return ok
+		}
+
+		var links []*extractedLink
+		for _, l := range md.links {
+			if allowed(l.url) {
+				links = append(links, l)
+			}
+		}
+
+		var urls []*url.URL
+		for _, u := range md.urls {
+			if allowed(u) {
+				urls = append(urls, u)
+			}
+		}
+
+		md.links, md.urls = links, urls
+		g.skippedURLs[source] = append(g.skippedURLs[source], filtered...)
+		emitSkip(g, source, filtered, SkipFiltered)
+		return true
+	})
+}
+
+// linkGraphProcessor records the links from the source url to the urls it links to.
+// links that are not followed are queued for checking if links are checked
+func linkGraphProcessor() processor {
+	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
+		followed := make(map[*url.URL]bool)
+		for _, u := range md.urls {
+			followed[u] = true
+		}
+
+		var recorded []*url.URL
+		for _, l := range md.links {
+			g.links = append(g.links, newLink(md.sourceURL.String(), l))
+			g.inlinks[l.url.String()]++
+
+			if !followed[l.url] {
+				recorded = append(recorded, l.url)
+			}
+		}
+
+		if g.checkLinks {
+			queueChecks(g, md.depth, md.sourceURL.String(), recorded)
+		}
+
+		return true
+	})
+}
+
+// pageRelationsProcessor records the relations declared by the source url page
+func pageRelationsProcessor() processor {
+	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
+		if md.relations != nil {
+			g.relations[md.sourceURL.String()] = md.relations
+		}
+
+		return true
+	})
+}
+
+// recordProcessor records the fields extracted from the source url page by the rules
+func recordProcessor() processor {
+	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
+		if md.page != nil && md.page.Record != nil {
+			g.records[md.sourceURL.String()] = md.page.Record
+		}
+
+		return true
+	})
+}
+
 // uniqueURLProcessor adds source url to unique crawled and remove any urls from the
 // minion dump that are already crawled
 func uniqueURLProcessor() processor {
 	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
 		g.scrappedUnique[md.sourceURL.String()]++
+		normalizeURLs(g.normalizer, md.urls)
 		var unique []*url.URL
 		for _, u := range md.urls {
+			if _, ok := g.disallowedURLs[u.String()]; ok {
+				continue
+			}
+
+			if _, ok := g.redirects[u.String()]; ok {
+				continue
+			}
+
+			if _, ok := g.inFlight[u.String()]; ok {
+				// being crawled already
+				continue
+			}
+
+			if retrying(g, u.String()) {
+				// will be crawled again after the backoff
+				continue
+			}
+
 			if _, ok := g.scrappedUnique[u.String()]; !ok {
 				unique = append(unique, u)
 				continue
@@ -43,19 +258,43 @@ func errorCheckProcessor() processor {
 		}
 
 		g.errorURLs[md.sourceURL.String()] = md.err
+		if g.hooks.OnError != nil {
+			g.hooks.OnError(md.sourceURL.String(), md.err)
+		}
+
 		return false
 	})
 }
 
+// pageProcessor records the crawled source url page along with its Last-Modified and calls the OnPage hook with it
+func pageProcessor() processor {
+	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
+		if md.page != nil {
+			g.pages[md.sourceURL.String()] = PageInfo{Noindex: md.noindex}
+			if lm, err := http.ParseTime(md.page.Header.Get("Last-Modified")); err == nil {
+				g.lastMod[md.sourceURL.String()] = lm.UTC()
+			}
+		}
+
+		if g.hooks.OnPage != nil {
+			g.hooks.OnPage(newPage(md))
+		}
+
+		return true
+	})
+}
+
 // skippedURLProcessor will simply add the unknown urls to skipped map
 func skippedURLProcessor() processor {
 	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
 		g.skippedURLs[md.sourceURL.String()] = append(g.skippedURLs[md.sourceURL.String()], md.invalidURLs...)
+		emitSkip(g, md.sourceURL.String(), md.invalidURLs, SkipInvalid)
 		return true
 	})
 }
 
-// maxDepthCheckProcessor will add the unscrapped urls to scrapped if the max depth has been reached
+// maxDepthCheckProcessor will add the unscrapped urls to scrapped if the max depth has been reached.
+// urls are queued for checking if links are checked
 func maxDepthCheckProcessor() processor {
 	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
 		if g.maxDepth == -1 || md.depth < g.maxDepth {
@@ -68,6 +307,10 @@ func maxDepthCheckProcessor() processor {
 		}
 
 		g.scrapped[md.depth] = append(g.scrapped[md.depth], md.urls...)
+		if g.checkLinks {
+			queueChecks(g, md.depth, md.sourceURL.String(), md.urls)
+		}
+
 		for _, u := range md.urls {
 			if g.domainRegex.MatchString(u.Hostname()) {
 				g.scrappedUnique[u.String()]++
@@ -78,7 +321,8 @@ func maxDepthCheckProcessor() processor {
 	})
 }
 
-// domainFilterProcessor will filter the md.urls and update skipped urls with unmatched urls
+// domainFilterProcessor will filter the md.urls and update skipped urls with unmatched urls.
+// unmatched urls are queued for checking if links are checked
 func domainFilterProcessor() processor {
 	return processorFunc(func(g *gru, md *minionDump) (proceed bool) {
 		if g.domainRegex == nil {
@@ -87,6 +331,7 @@ func domainFilterProcessor() processor {
 
 		m := []*url.URL{}
 		um := []string{}
+		var umURLs []*url.URL
 		for _, u := range md.urls {
 			if g.domainRegex.MatchString(u.Hostname()) {
 				m = append(m, u)
@@ -94,10 +339,16 @@ func domainFilterProcessor() processor {
 			}
 
 			um = append(um, u.String())
+			umURLs = append(umURLs, u)
 		}
 
 		md.urls = m
 		g.skippedURLs[md.sourceURL.String()] = append(g.skippedURLs[md.sourceURL.String()], um...)
+		emitSkip(g, md.sourceURL.String(), um, SkipDomain)
+		if g.checkLinks {
+			queueChecks(g, md.depth, md.sourceURL.String(), umURLs)
+		}
+
 		return true
 	})
 }
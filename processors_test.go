@@ -319,3 +319,110 @@ func TestProcessor_domainFilterProcessor(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessor_linkGraphProcessor(t *testing.T) {
+	b, _ := url.Parse("http://test.com")
+	g := newGru(b, 1)
+	u1, _ := url.Parse("http://test.com/1")
+	u2, _ := url.Parse("http://github.com")
+	md := &minionDump{
+		sourceURL: b,
+		urls:      []*url.URL{u1, u2},
+		links: []*extractedLink{
+			{url: u1, text: "one", tag: "a", attr: "href"},
+			{url: u2, text: "github", tag: "a", attr: "href"},
+		},
+	}
+
+	if !linkGraphProcessor().process(g, md) {
+		t.Fatal("expected link graph processor to proceed")
+	}
+
+	expected := []Link{
+		{Source: "http://test.com", Target: "http://test.com/1", Text: "one", Tag: "a", Attr: "href"},
+		{Source: "http://test.com", Target: "http://github.com", Text: "github", Tag: "a", Attr: "href"},
+	}
+
+	if !reflect.DeepEqual(g.links, expected) {
+		t.Fatalf("expected links %v but got %v", expected, g.links)
+	}
+
+	resp := gruToResponse(g)
+	if len(resp.Outlinks("http://test.com")) != 2 || len(resp.Outlinks("http://test.com/1")) != 0 {
+		t.Fatalf("unexpected outlinks: %v", resp.Outlinks("http://test.com"))
+	}
+
+	if r := resp.Referrers("http://github.com"); len(r) != 1 || r[0].Text != "github" {
+		t.Fatalf("unexpected referrers: %v", r)
+	}
+}
+
+func TestProcessor_uniqueURLProcessorNormalizes(t *testing.T) {
+	bu, _ := url.Parse("http://example.com/")
+	g := newGru(bu, -1)
+	g.normalizer = DefaultNormalizer
+	g.scrappedUnique["http://example.com/b"] = 1
+
+	u1, _ := url.Parse("HTTP://Example.com:80/a/../b?utm_source=x")
+	u2, _ := url.Parse("http://example.com/c")
+	md := &minionDump{sourceURL: bu, urls: []*url.URL{u1, u2}}
+	uniqueURLProcessor().process(g, md)
+	if len(md.urls) != 1 || md.urls[0].String() != "http://example.com/c" {
+		t.Fatalf("expected only http://example.com/c to be unique but got %v", md.urls)
+	}
+
+	if g.scrappedUnique["http://example.com/b"] != 2 {
+		t.Fatalf("expected http://example.com/b to be repeated but got %v", g.scrappedUnique)
+	}
+}
+
+func TestProcessor_redirectProcessor(t *testing.T) {
+	bu, _ := url.Parse("http://test.com/")
+	final, _ := url.Parse("http://test.com/new")
+	tests := []struct {
+		crawled  bool
+		inFlight bool
+		queued   bool
+		proceed  bool
+	}{
+		{proceed: true},
+		{crawled: true},
+		{inFlight: true},
+		{queued: true},
+	}
+
+	for _, c := range tests {
+		g := newGru(bu, -1)
+		if c.crawled {
+			g.scrappedUnique[final.String()] = 1
+		}
+
+		if c.inFlight {
+			g.inFlight[final.String()] = inFlightURL{depth: 1}
+		}
+
+		if c.queued {
+			pushURLs(g.unScrapped, 1, "", final)
+		}
+
+		src, _ := url.Parse("http://test.com/old")
+		md := &minionDump{
+			sourceURL: src,
+			finalURL:  final,
+			depth:     1,
+			redirects: []Redirect{{From: src.String(), To: final.String(), StatusCode: 301}},
+		}
+
+		if r := redirectProcessor().process(g, md); r != c.proceed {
+			t.Fatalf("expected %t for %+v but got %t", c.proceed, c, r)
+		}
+
+		if r := g.scrappedUnique[final.String()]; (c.crawled && r != 2) || (!c.crawled && r != 0) {
+			t.Fatalf("unexpected count %d of the final url for %+v", r, c)
+		}
+
+		if c.proceed && md.sourceURL != final {
+			t.Fatalf("expected source url to be the final url but got %v", md.sourceURL)
+		}
+	}
+}
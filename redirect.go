@@ -0,0 +1,107 @@
+package scrape
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// defaultMaxRedirects is the max redirect hops followed for a single url
+const defaultMaxRedirects = 10
+
+// errOffDomainRedirect is returned when the url redirects to an url failing domainRegex
+var errOffDomainRedirect = errors.New("redirected to an url failing domain regex")
+
+// blockedRedirectError is returned when the url redirects to an url disallowed by robots.txt or excluded by the url rules
+type blockedRedirectError struct {
+	disallowedBy string // disallowedBy is the robots.txt rule disallowing the redirect target
+	filteredBy   string // filteredBy is the reason the url rules exclude the redirect target
+}
+
+// Error returns the reason the redirect is not followed
+func (e *blockedRedirectError) Error() string {
+	if e.disallowedBy != "" {
+		return "redirected to an url disallowed by robots.txt: " + e.disallowedBy
+	}
+
+	return "redirected to an url excluded by the url rules: " + e.filteredBy
+}
+
+// Redirect is a single hop in the redirect chain of an url
+type Redirect struct {
+	From       string // From is the url that redirected
+	To         string // To is the url redirected to
+	StatusCode int    // StatusCode of the redirect response
+}
+
+// isRedirect says if the status code is a redirect that can be followed
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
+
+// fetchURL fetches the url following the redirects one hop at a time and returns the final response along with the chain.
+// stops at the first redirect to an url failing cfg.domainRegex, disallowed by robots.txt or excluded by the url rules
+func fetchURL(cfg *crawlConfig, u *url.URL) (resp *http.Response, redirects []Redirect, err error) {
+	client := *cfg.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	cur := u
+	seen := map[string]bool{u.String(): true}
+	for {
+		resp, err = client.Get(cur.String())
+		if err != nil {
+			return nil, redirects, err
+		}
+
+		loc := resp.Header.Get("Location")
+		if !isRedirect(resp.StatusCode) || loc == "" {
+			return resp, redirects, nil
+		}
+		resp.Body.Close()
+
+		next, err := resolveURL(cur, loc)
+		if err != nil {
+			return nil, redirects, err
+		}
+
+		if cfg.normalizer != nil {
+			next = cfg.normalizer.Normalize(next)
+		}
+
+		redirects = append(redirects, Redirect{From: cur.String(), To: next.String(), StatusCode: resp.StatusCode})
+		if seen[next.String()] {
+			return nil, redirects, &RedirectLoopError{URL: u.String(), Redirects: redirects}
+		}
+
+		if len(redirects) > cfg.maxRedirects {
+			return nil, redirects, &TooManyRedirectsError{URL: u.String(), Redirects: redirects}
+		}
+
+		if cfg.domainRegex != nil && !cfg.domainRegex.MatchString(next.Hostname()) {
+			return nil, redirects, errOffDomainRedirect
+		}
+
+		if cfg.robots != nil {
+			if ok, rule := allowedByRobots(cfg.robots, next); !ok {
+				return nil, redirects, &blockedRedirectError{disallowedBy: rule}
+			}
+
+			waitForCrawlDelay(cfg.robots, next)
+		}
+
+		if ok, rule := filterURL(cfg.urlRules, next); !ok {
+			return nil, redirects, &blockedRedirectError{filteredBy: filterReason(rule)}
+		}
+
+		seen[next.String()] = true
+		cur = next
+	}
+}
@@ -0,0 +1,161 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func redirectServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/old">old</a><a href="/moved">moved</a><a href="/loop">loop</a><a href="/away">away</a>`)
+	})
+	mux.Handle("/old", http.RedirectHandler("/moved", http.StatusMovedPermanently))
+	mux.Handle("/moved", http.RedirectHandler("/docs/new", http.StatusFound))
+	mux.HandleFunc("/docs/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="page">page</a>`)
+	})
+	mux.HandleFunc("/docs/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+	})
+	mux.Handle("/loop", http.RedirectHandler("/loop2", http.StatusTemporaryRedirect))
+	mux.Handle("/loop2", http.RedirectHandler("/loop", http.StatusTemporaryRedirect))
+	mux.Handle("/away", http.RedirectHandler("http://example.com/", http.StatusFound))
+	return httptest.NewServer(mux)
+}
+
+func Test_fetchURL(t *testing.T) {
+	ts := redirectServer()
+	defer ts.Close()
+
+	tests := []struct {
+		path      string
+		redirects int
+		maxHops   int
+		err       error
+	}{
+		{path: "/", maxHops: 10},
+		{path: "/old", redirects: 2, maxHops: 10},
+		{path: "/old", redirects: 2, maxHops: 1, err: &TooManyRedirectsError{}},
+		{path: "/loop", redirects: 2, maxHops: 10, err: &RedirectLoopError{}},
+		{path: "/away", redirects: 1, maxHops: 10, err: errOffDomainRedirect},
+	}
+
+	for _, c := range tests {
+		cfg := newCrawlConfig(http.DefaultClient)
+		cfg.maxRedirects = c.maxHops
+		cfg.domainRegex = regexp.MustCompile("127.0.0.1")
+		u, _ := url.Parse(ts.URL + c.path)
+		resp, redirects, err := fetchURL(cfg, u)
+		if len(redirects) != c.redirects {
+			t.Fatalf("%s: expected %d redirects but got %v", c.path, c.redirects, redirects)
+		}
+
+		if fmt.Sprintf("%T", err) != fmt.Sprintf("%T", c.err) || (c.err == errOffDomainRedirect && err != c.err) {
+			t.Fatalf("%s: expected %T error but got %v", c.path, c.err, err)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200 but got %d", c.path, resp.StatusCode)
+		}
+	}
+}
+
+func TestCrawler_RunRedirects(t *testing.T) {
+	ts := redirectServer()
+	defer ts.Close()
+
+	resp, err := New(WithWorkers(2), WithIgnoreRobots(true)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, u := range []string{"/", "/docs/new", "/docs/page"} {
+		if _, ok := resp.UniqueURLs[ts.URL+u]; !ok {
+			t.Fatalf("expected %s to be crawled but got %v", u, resp.UniqueURLs)
+		}
+	}
+
+	for _, u := range []string{"/old", "/moved"} {
+		if _, ok := resp.UniqueURLs[ts.URL+u]; ok {
+			t.Fatalf("expected %s to be deduped on final url but got %v", u, resp.UniqueURLs)
+		}
+	}
+
+	if r := resp.Redirects[ts.URL+"/old"]; len(r) != 2 || r[1].To != ts.URL+"/docs/new" || r[0].StatusCode != http.StatusMovedPermanently {
+		t.Fatalf("unexpected redirect chain of /old: %v", r)
+	}
+
+	if r := resp.Referrers(ts.URL + "/docs/page"); len(r) != 1 || r[0].Source != ts.URL+"/docs/new" {
+		t.Fatalf("expected /docs/page to be referred by the final url but got %v", r)
+	}
+
+	if _, ok := resp.ErrorURLs[ts.URL+"/loop"].(*RedirectLoopError); !ok {
+		t.Fatalf("expected redirect loop error but got %v", resp.ErrorURLs[ts.URL+"/loop"])
+	}
+
+	if s := resp.SkippedURLs[ts.URL+"/away"]; len(s) != 1 || s[0] != "http://example.com/" {
+		t.Fatalf("expected off domain redirect to be skipped but got %v", s)
+	}
+}
+
+func TestCrawler_RunRedirectsBlocked(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/go">go</a><a href="/out">out</a>`)
+	})
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+	})
+	mux.Handle("/go", http.RedirectHandler("/private/x", http.StatusFound))
+	mux.Handle("/out", http.RedirectHandler("/excluded/y", http.StatusFound))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	exc, _ := Exclude("path:^/excluded")
+	resp, err := New(WithURLRules(exc)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if hits["/private/x"] != 0 || hits["/excluded/y"] != 0 {
+		t.Fatalf("expected blocked redirect targets not to be requested but got %v", hits)
+	}
+
+	for _, u := range []string{"/private/x", "/excluded/y", "/go", "/out"} {
+		if _, ok := resp.UniqueURLs[ts.URL+u]; ok {
+			t.Fatalf("expected %s not to be crawled but got %v", u, resp.UniqueURLs)
+		}
+	}
+
+	if rule := resp.DisallowedURLs[ts.URL+"/private/x"]; rule == "" {
+		t.Fatalf("expected /private/x to be disallowed but got %v", resp.DisallowedURLs)
+	}
+
+	if rule := resp.FilteredURLs[ts.URL+"/excluded/y"]; rule != "exclude path:^/excluded" {
+		t.Fatalf("expected /excluded/y to be filtered but got %v", resp.FilteredURLs)
+	}
+
+	if r := resp.Redirects[ts.URL+"/go"]; len(r) != 1 || r[0].To != ts.URL+"/private/x" {
+		t.Fatalf("expected redirect of /go to be recorded but got %v", r)
+	}
+}
@@ -0,0 +1,197 @@
+package scrape
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy defines how the transient fetch failures are retried
+type RetryPolicy struct {
+	MaxAttempts int           // MaxAttempts including the first one. 1 or less disables retries
+	BaseDelay   time.Duration // BaseDelay is the backoff before the first retry. Doubles on every retry
+	MaxDelay    time.Duration // MaxDelay caps the backoff. Retry-After beyond MaxDelay is not retried
+	Jitter      float64       // Jitter randomises the backoff by the fraction, between 0 and 1
+}
+
+// DefaultRetryPolicy is the retry policy used by default
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+	Jitter:      0.2,
+}
+
+// Attempt is a single fetch attempt of an url
+type Attempt struct {
+	At    time.Time     // At is the time attempt's result was processed
+	Err   error         // Err of the attempt. nil if the attempt succeeded
+	Retry time.Duration // Retry is the backoff before the next attempt. 0 if not retried
+}
+
+// retryURL is an url waiting for its backoff to be retried
+type retryURL struct {
+	depth  int       // depth of the url
+	u      *url.URL  // url to retry
+	source string    // source is the page the url is found on
+	at     time.Time // at is the time after which url can be retried
+}
+
+// isTransientStatus says if the status code is worth retrying
+func isTransientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// isTransientErr says if the fetch error is worth retrying
+func isTransientErr(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// parseRetryAfter parses the Retry-After header given in seconds or http date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if s, err := strconv.Atoi(value); err == nil {
+		if s < 0 {
+			return 0
+		}
+
+		return time.Duration(s) * time.Second
+	}
+
+	t, err := http.ParseTime(value)
+	if err != nil || t.Before(now) {
+		return 0
+	}
+
+	return t.Sub(now)
+}
+
+// backoff returns the delay before the given attempt is retried.
+// returns false if the attempt should not be retried
+func backoff(p *RetryPolicy, attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	if p.MaxDelay > 0 && retryAfter > p.MaxDelay {
+		return 0, false
+	}
+
+	delay := p.BaseDelay << uint(attempt-1)
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay <= 0) {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+	}
+
+	if delay < retryAfter {
+		delay = retryAfter
+	}
+
+	return delay, true
+}
+
+// retryDump schedules the source url of the dump to be retried if it failed transiently
+// and records the attempt. returns true if the url is scheduled for retry
+func retryDump(g *gru, md *minionDump, source string) bool {
+	key := md.sourceURL.String()
+	attempts, retried := g.attempts[key]
+	if md.err == nil {
+		if retried {
+			g.attempts[key] = append(attempts, Attempt{At: time.Now()})
+		}
+
+		return false
+	}
+
+	if g.retry == nil || !md.transient {
+		if retried {
+			g.attempts[key] = append(attempts, Attempt{At: time.Now(), Err: md.err})
+		}
+
+		return false
+	}
+
+	delay, ok := backoff(g.retry, len(attempts)+1, md.retryAfter)
+	if !ok {
+		if retried {
+			g.attempts[key] = append(attempts, Attempt{At: time.Now(), Err: md.err})
+		}
+
+		return false
+	}
+
+	now := time.Now()
+	g.attempts[key] = append(attempts, Attempt{At: now, Err: md.err, Retry: delay})
+	g.retryQueue = append(g.retryQueue, &retryURL{
+		depth:  md.depth - 1,
+		u:      md.sourceURL,
+		source: source,
+		at:     now.Add(delay),
+	})
+
+	log.Printf("retrying %s in %v: %v\n", key, delay, md.err)
+	scheduleWake(g, delay)
+	return true
+}
+
+// retrying says if the url is waiting for its backoff to be retried
+func retrying(g *gru, u string) bool {
+	for _, r := range g.retryQueue {
+		if r.u.String() == u {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requeueRetries moves the urls whose backoff is done to unScrapped.
+// urls crawled, being crawled or queued in the meantime are dropped
+func requeueRetries(g *gru) {
+	now := time.Now()
+	var waiting []*retryURL
+	for _, r := range g.retryQueue {
+		if r.at.After(now) {
+			waiting = append(waiting, r)
+			continue
+		}
+
+		u := r.u.String()
+		if _, ok := g.scrappedUnique[u]; ok {
+			continue
+		}
+
+		if _, ok := g.inFlight[u]; ok {
+			continue
+		}
+
+		if _, ok := g.unScrapped.queued[u]; ok {
+			continue
+		}
+
+		pushURLs(g.unScrapped, r.depth, r.source, r.u)
+	}
+
+	g.retryQueue = waiting
+}
@@ -0,0 +1,205 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{},
+		{value: "120", expected: 2 * time.Minute},
+		{value: "-1"},
+		{value: "invalid"},
+		{value: now.Add(-time.Minute).UTC().Format(http.TimeFormat)},
+	}
+
+	for _, c := range tests {
+		d := parseRetryAfter(c.value, now)
+		if d != c.expected {
+			t.Fatalf("expected %v for %q but got %v", c.expected, c.value, d)
+		}
+	}
+
+	future := now.Add(time.Minute).Truncate(time.Second)
+	d := parseRetryAfter(future.UTC().Format(http.TimeFormat), now)
+	if d <= 0 || d > time.Minute {
+		t.Fatalf("unexpected retry after for http date: %v", d)
+	}
+}
+
+func Test_backoff(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	tests := []struct {
+		attempt    int
+		retryAfter time.Duration
+		delay      time.Duration
+		ok         bool
+	}{
+		{attempt: 1, delay: time.Second, ok: true},
+		{attempt: 2, delay: 2 * time.Second, ok: true},
+		{attempt: 3, delay: 4 * time.Second, ok: true},
+		{attempt: 4, delay: 5 * time.Second, ok: true},
+		{attempt: 5},
+		{attempt: 1, retryAfter: 3 * time.Second, delay: 3 * time.Second, ok: true},
+		{attempt: 1, retryAfter: time.Minute},
+	}
+
+	for _, c := range tests {
+		delay, ok := backoff(p, c.attempt, c.retryAfter)
+		if delay != c.delay || ok != c.ok {
+			t.Fatalf("expected %v(%t) for attempt %d but got %v(%t)", c.delay, c.ok, c.attempt, delay, ok)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		delay, _ := backoff(p, 2, 0)
+		if delay < time.Second || delay > 3*time.Second {
+			t.Fatalf("jittered delay out of range: %v", delay)
+		}
+	}
+}
+
+func Test_requeueRetries(t *testing.T) {
+	bu, _ := url.Parse("http://test.com/")
+	g := newGru(bu, -1)
+	urls, _ := urlStrToURLs([]string{"http://test.com/crawled", "http://test.com/busy", "http://test.com/queued", "http://test.com/retry", "http://test.com/waiting"})
+	g.scrappedUnique[urls[0].String()] = 1
+	g.inFlight[urls[1].String()] = inFlightURL{depth: 1}
+	pushURLs(g.unScrapped, 1, "", urls[2])
+	for i, u := range urls {
+		at := time.Now()
+		if i == 4 {
+			at = at.Add(time.Hour)
+		}
+
+		g.retryQueue = append(g.retryQueue, &retryURL{depth: 1, u: u, at: at})
+	}
+
+	requeueRetries(g)
+	queued := frontierURLs(g.unScrapped)[1]
+	if len(queued) != 2 || queued[1] != urls[3] || len(g.retryQueue) != 1 || g.retryQueue[0].u != urls[4] {
+		t.Fatalf("expected only %v to be requeued but got %v with %d waiting", urls[3], queued, len(g.retryQueue))
+	}
+
+	if !retrying(g, urls[4].String()) || retrying(g, urls[3].String()) {
+		t.Fatalf("expected only %v to be retrying", urls[4])
+	}
+}
+
+func TestCrawler_RunRetryLinkedInBackoff(t *testing.T) {
+	// /b links to /a while /a is waiting for its backoff
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/a">a</a><a href="/b">b</a>`)
+		case "/a":
+			if n == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/b":
+			for i := 0; i < 100; i++ {
+				mu.Lock()
+				failed := hits["/a"] > 0
+				mu.Unlock()
+				if failed {
+					break
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			fmt.Fprint(w, `<a href="/a">a</a>`)
+		}
+	}))
+	defer ts.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: 300 * time.Millisecond, MaxDelay: time.Second}
+	resp, err := New(WithWorkers(2), WithRetryPolicy(policy), WithIgnoreRobots(true)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	attempts := resp.Attempts[ts.URL+"/a"]
+	if hits["/a"] != 2 || len(attempts) != 2 || attempts[1].Err != nil || resp.UniqueURLs[ts.URL+"/a"] != 1 {
+		t.Fatalf("expected /a to be crawled only by the retry but got %d hits, %v attempts and %v", hits["/a"], attempts, resp.UniqueURLs)
+	}
+}
+
+func TestCrawler_RunWithRetries(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/flaky">flaky</a><a href="/dead">dead</a><a href="/missing">missing</a>`)
+		case "/flaky":
+			if n < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "ok")
+		case "/dead":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: time.Second}
+	resp, err := New(WithRetryPolicy(policy), WithIgnoreRobots(true)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	flaky := resp.Attempts[ts.URL+"/flaky"]
+	if len(flaky) != 3 || flaky[2].Err != nil || flaky[0].Retry == 0 {
+		t.Fatalf("expected flaky url to succeed on 3rd attempt but got %v", flaky)
+	}
+
+	dead := resp.Attempts[ts.URL+"/dead"]
+	if len(dead) != 3 || dead[2].Err == nil || dead[2].Retry != 0 {
+		t.Fatalf("expected dead url to fail after 3 attempts but got %v", dead)
+	}
+
+	if _, ok := resp.Attempts[ts.URL+"/missing"]; ok {
+		t.Fatal("expected missing url to not be retried")
+	}
+
+	if _, ok := resp.ErrorURLs[ts.URL+"/dead"]; !ok {
+		t.Fatal("expected dead url in error urls")
+	}
+
+	if _, ok := resp.ErrorURLs[ts.URL+"/flaky"]; ok {
+		t.Fatal("expected flaky url to not be in error urls")
+	}
+}
@@ -0,0 +1,291 @@
+package scrape
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robotsRule is a single allow/disallow rule of robots.txt
+type robotsRule struct {
+	allow bool   // allow is true for Allow rules
+	path  string // path pattern of the rule. supports * and $
+}
+
+// String returns the rule as written in robots.txt
+func (r robotsRule) String() string {
+	if r.allow {
+		return "Allow: " + r.path
+	}
+
+	return "Disallow: " + r.path
+}
+
+// robotsRules holds the robots.txt rules that apply to a user agent
+type robotsRules struct {
+	rules      []robotsRule  // rules sorted by longest path first
+	crawlDelay time.Duration // crawlDelay between two requests to the host
+	sitemaps   []string      // sitemaps listed in robots.txt
+}
+
+// robotsGroup is a group of rules for a set of user agents
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// userAgentToken returns the product token of the user agent used to match robots.txt groups
+func userAgentToken(userAgent string) string {
+	token := strings.TrimSpace(userAgent)
+	if i := strings.IndexAny(token, "/ "); i != -1 {
+		token = token[:i]
+	}
+
+	return strings.ToLower(token)
+}
+
+// parseRobots parses robots.txt and returns the rules that apply to given user agent.
+// Rules of the most specific matching group are used, falling back to the * group
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	var groups []*robotsGroup
+	var current *robotsGroup
+	rr := &robotsRules{}
+	inAgents := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+
+		i := strings.Index(line, ":")
+		if i == -1 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+		switch key {
+		case "user-agent":
+			if !inAgents || current == nil {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+			}
+
+			current.agents = append(current.agents, strings.ToLower(value))
+			inAgents = true
+			continue
+		case "sitemap":
+			rr.sitemaps = append(rr.sitemaps, value)
+		case "allow", "disallow":
+			// empty disallow allows everything
+			if current != nil && value != "" {
+				current.rules = append(current.rules, robotsRule{allow: key == "allow", path: value})
+			}
+		case "crawl-delay":
+			d, err := strconv.ParseFloat(value, 64)
+			if current != nil && err == nil && d > 0 {
+				current.crawlDelay = time.Duration(d * float64(time.Second))
+			}
+		}
+
+		inAgents = false
+	}
+
+	token := userAgentToken(userAgent)
+	var matched []*robotsGroup
+	matchedLen := -1
+	for _, g := range groups {
+		for _, a := range g.agents {
+			l := -1
+			switch {
+			case a == "*":
+				l = 0
+			case token != "" && strings.Contains(token, a):
+				l = len(a)
+			}
+
+			if l < 0 || l < matchedLen {
+				continue
+			}
+
+			if l > matchedLen {
+				matched = nil
+				matchedLen = l
+			}
+
+			matched = append(matched, g)
+			break
+		}
+	}
+
+	for _, g := range matched {
+		rr.rules = append(rr.rules, g.rules...)
+		if g.crawlDelay > rr.crawlDelay {
+			rr.crawlDelay = g.crawlDelay
+		}
+	}
+
+	// longest path first, allow wins on ties
+	sort.SliceStable(rr.rules, func(i, j int) bool {
+		if len(rr.rules[i].path) != len(rr.rules[j].path) {
+			return len(rr.rules[i].path) > len(rr.rules[j].path)
+		}
+
+		return rr.rules[i].allow && !rr.rules[j].allow
+	})
+
+	return rr
+}
+
+// matchRobotsPath matches the path against robots.txt path pattern supporting * and $
+func matchRobotsPath(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+
+	rest := path[len(parts[0]):]
+	for _, p := range parts[1:] {
+		i := strings.Index(rest, p)
+		if i == -1 {
+			return false
+		}
+
+		rest = rest[i+len(p):]
+	}
+
+	if !anchored || rest == "" {
+		return true
+	}
+
+	// the last part must end the path
+	last := parts[len(parts)-1]
+	return len(parts) > 1 && strings.HasSuffix(path, last)
+}
+
+// isAllowedByRobots checks the url against the rules and returns the rule that disallowed it
+func isAllowedByRobots(rr *robotsRules, u *url.URL) (allowed bool, rule string) {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	for _, r := range rr.rules {
+		if matchRobotsPath(r.path, path) {
+			return r.allow, r.String()
+		}
+	}
+
+	return true, ""
+}
+
+// robotsHost holds the robots.txt state of a single host
+type robotsHost struct {
+	mu          sync.Mutex   // protects the below and serialises the fetch
+	rules       *robotsRules // rules is nil until robots.txt is fetched
+	nextRequest time.Time    // nextRequest is the earliest time the host can be requested as per crawl delay
+}
+
+// robotsCache fetches and caches robots.txt per host
+type robotsCache struct {
+	client    *http.Client           // client to fetch robots.txt
+	userAgent string                 // userAgent the rules are evaluated for
+	mu        *sync.Mutex            // protects hosts
+	hosts     map[string]*robotsHost // hosts is keyed by scheme://host
+}
+
+// newRobotsCache returns a new robots cache for the user agent
+func newRobotsCache(client *http.Client, userAgent string) *robotsCache {
+	return &robotsCache{
+		client:    client,
+		userAgent: userAgent,
+		mu:        &sync.Mutex{},
+		hosts:     make(map[string]*robotsHost),
+	}
+}
+
+// fetchRobots fetches and parses the robots.txt of the host.
+// 4xx and unreachable robots.txt allows everything while 5xx disallows everything
+func fetchRobots(client *http.Client, userAgent string, u *url.URL) *robotsRules {
+	ru := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	resp, err := client.Get(ru.String())
+	if err != nil {
+		log.Printf("failed to fetch %s: %v\n", ru, err)
+		return &robotsRules{}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		log.Printf("%s responded with code %d. disallowing the host\n", ru, resp.StatusCode)
+		return &robotsRules{rules: []robotsRule{{path: "/"}}}
+	case resp.StatusCode >= 400:
+		return &robotsRules{}
+	}
+
+	return parseRobots(io.LimitReader(resp.Body, 500<<10), userAgent)
+}
+
+// robotsForURL returns the robots host state of the url, fetching robots.txt if not cached
+func robotsForURL(rc *robotsCache, u *url.URL) *robotsHost {
+	key := u.Scheme + "://" + u.Host
+	rc.mu.Lock()
+	rh, ok := rc.hosts[key]
+	if !ok {
+		rh = &robotsHost{}
+		rc.hosts[key] = rh
+	}
+	rc.mu.Unlock()
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+	if rh.rules == nil {
+		rh.rules = fetchRobots(rc.client, rc.userAgent, u)
+	}
+
+	return rh
+}
+
+// allowedByRobots says if the url can be crawled and the rule that disallowed it
+func allowedByRobots(rc *robotsCache, u *url.URL) (allowed bool, rule string) {
+	rh := robotsForURL(rc, u)
+	return isAllowedByRobots(rh.rules, u)
+}
+
+// waitForCrawlDelay blocks until the host of the url can be requested as per its crawl delay
+func waitForCrawlDelay(rc *robotsCache, u *url.URL) {
+	rh := robotsForURL(rc, u)
+	rh.mu.Lock()
+	if rh.rules.crawlDelay == 0 {
+		rh.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	next := rh.nextRequest
+	if next.Before(now) {
+		next = now
+	}
+
+	rh.nextRequest = next.Add(rh.rules.crawlDelay)
+	rh.mu.Unlock()
+	time.Sleep(next.Sub(now))
+}
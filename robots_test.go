@@ -0,0 +1,191 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRobots = `
+# comment
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Crawl-delay: 1
+
+User-agent: scrape
+User-agent: other
+Disallow: /2
+Disallow: /search?q=
+Crawl-delay: 0.5
+
+User-agent: badbot
+Disallow: /
+
+Sitemap: http://test.com/sitemap.xml
+`
+
+func Test_parseRobots(t *testing.T) {
+	tests := []struct {
+		userAgent  string
+		rules      int
+		crawlDelay time.Duration
+	}{
+		{
+			userAgent:  "Scrape/1.0",
+			rules:      2,
+			crawlDelay: 500 * time.Millisecond,
+		},
+
+		{
+			userAgent:  "Googlebot/2.1",
+			rules:      3,
+			crawlDelay: time.Second,
+		},
+
+		{
+			userAgent: "BadBot",
+			rules:     1,
+		},
+	}
+
+	for _, c := range tests {
+		rr := parseRobots(strings.NewReader(testRobots), c.userAgent)
+		if len(rr.rules) != c.rules {
+			t.Fatalf("expected %d rules for %s but got %v", c.rules, c.userAgent, rr.rules)
+		}
+
+		if rr.crawlDelay != c.crawlDelay {
+			t.Fatalf("expected crawl delay %v but got %v", c.crawlDelay, rr.crawlDelay)
+		}
+
+		if len(rr.sitemaps) != 1 || rr.sitemaps[0] != "http://test.com/sitemap.xml" {
+			t.Fatalf("unexpected sitemaps: %v", rr.sitemaps)
+		}
+	}
+}
+
+func Test_isAllowedByRobots(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		u         string
+		allowed   bool
+		rule      string
+	}{
+		{
+			userAgent: "googlebot",
+			u:         "http://test.com/private/1",
+			rule:      "Disallow: /private",
+		},
+
+		{
+			userAgent: "googlebot",
+			u:         "http://test.com/private/public/1",
+			allowed:   true,
+			rule:      "Allow: /private/public",
+		},
+
+		{
+			userAgent: "googlebot",
+			u:         "http://test.com/files/a.pdf",
+			rule:      "Disallow: /*.pdf$",
+		},
+
+		{
+			userAgent: "googlebot",
+			u:         "http://test.com/files/a.pdf?download=1",
+			allowed:   true,
+		},
+
+		{
+			userAgent: "scrape",
+			u:         "http://test.com/private/1",
+			allowed:   true,
+		},
+
+		{
+			userAgent: "scrape",
+			u:         "http://test.com/search?q=test",
+			rule:      "Disallow: /search?q=",
+		},
+
+		{
+			userAgent: "badbot",
+			u:         "http://test.com",
+			rule:      "Disallow: /",
+		},
+	}
+
+	for _, c := range tests {
+		rr := parseRobots(strings.NewReader(testRobots), c.userAgent)
+		u, _ := url.Parse(c.u)
+		allowed, rule := isAllowedByRobots(rr, u)
+		if allowed != c.allowed || rule != c.rule {
+			t.Fatalf("expected %s to be allowed(%t) by rule %q but got %t by %q", c.u, c.allowed, c.rule, allowed, rule)
+		}
+	}
+}
+
+func TestCrawler_RunWithRobots(t *testing.T) {
+	ts := testServer()
+	defer ts.Close()
+
+	robots := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			if r.Header.Get("User-Agent") != defaultUserAgent {
+				http.NotFound(w, r)
+				return
+			}
+
+			fmt.Fprint(w, "User-agent: *\nDisallow: /3\n")
+			return
+		}
+
+		ts.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer robots.Close()
+
+	tests := []struct {
+		opts       []Option
+		unique     int
+		disallowed int
+	}{
+		{
+			unique:     3,
+			disallowed: 1,
+		},
+
+		{
+			opts:   []Option{WithIgnoreRobots(true)},
+			unique: 4,
+		},
+	}
+
+	for _, c := range tests {
+		resp, err := New(c.opts...).Run(context.Background(), robots.URL+"/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(resp.UniqueURLs) != c.unique || len(resp.DisallowedURLs) != c.disallowed {
+			t.Fatalf("expected %d unique and %d disallowed urls but got %v and %v",
+				c.unique, c.disallowed, resp.UniqueURLs, resp.DisallowedURLs)
+		}
+
+		for u := range resp.DisallowedURLs {
+			for d, urls := range resp.URLsPerDepth {
+				for _, du := range urls {
+					if du.String() == u {
+						t.Fatalf("expected disallowed %s not to be recorded at depth %d", u, d)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package scrape
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v2"
+)
+
+// ExtractMode says what is extracted from the nodes matched by a rule
+type ExtractMode string
+
+// Extract modes of the rules
+const (
+	ExtractText ExtractMode = "text" // text content of the node
+	ExtractHTML ExtractMode = "html" // outer html of the node
+	ExtractAttr ExtractMode = "attr" // value of the attribute of the node
+)
+
+// Rule extracts a field from the page with either a CSS selector or an XPath
+type Rule struct {
+	Field    string      `yaml:"field"`    // Field the extracted value is recorded as
+	CSS      string      `yaml:"css"`      // CSS selector matching the nodes
+	XPath    string      `yaml:"xpath"`    // XPath matching the nodes
+	Mode     ExtractMode `yaml:"mode"`     // Mode of extraction. Defaults to text
+	Attr     string      `yaml:"attr"`     // Attr extracted in attr mode
+	Multiple bool        `yaml:"multiple"` // Multiple records all the matches instead of the first
+
+	css   cascadia.Selector // compiled css selector
+	xpath *xpath.Expr       // compiled xpath
+}
+
+// RuleSet holds the rules applied to the pages matching the url pattern
+type RuleSet struct {
+	URL   string  `yaml:"url"`   // URL is the regex the page url must match. empty matches all pages
+	Rules []*Rule `yaml:"rules"` // Rules applied to the matching pages
+
+	url      *regexp.Regexp // compiled url pattern
+	compiled bool           // compiled is true once the rules are compiled
+}
+
+// Record holds the fields extracted from a page. Values are strings, or []string for rules matching multiple nodes
+type Record map[string]interface{}
+
+// ParseRules parses and compiles the rule sets from the yaml
+func ParseRules(r io.Reader) ([]*RuleSet, error) {
+	var sets []*RuleSet
+	err := yaml.NewDecoder(r).Decode(&sets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %v", err)
+	}
+
+	for _, rs := range sets {
+		err = compileRuleSet(rs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sets, nil
+}
+
+// LoadRules parses and compiles the rule sets from the yaml file
+func LoadRules(file string) ([]*RuleSet, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseRules(f)
+}
+
+// compileRuleSet compiles the url pattern and the rules of the rule set
+func compileRuleSet(rs *RuleSet) (err error) {
+	if rs.compiled {
+		return nil
+	}
+
+	if rs.URL != "" {
+		rs.url, err = regexp.Compile(rs.URL)
+		if err != nil {
+			return fmt.Errorf("invalid rule set url %s: %v", rs.URL, err)
+		}
+	}
+
+	for _, r := range rs.Rules {
+		err = compileRule(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	rs.compiled = true
+	return nil
+}
+
+// compileRule validates and compiles the selector of the rule
+func compileRule(r *Rule) (err error) {
+	if r.Field == "" {
+		return fmt.Errorf("rule without field")
+	}
+
+	if (r.CSS == "") == (r.XPath == "") {
+		return fmt.Errorf("rule %s: exactly one of css or xpath is required", r.Field)
+	}
+
+	switch r.Mode {
+	case "":
+		r.Mode = ExtractText
+	case ExtractText, ExtractHTML:
+	case ExtractAttr:
+		if r.Attr == "" {
+			return fmt.Errorf("rule %s: attr is required in attr mode", r.Field)
+		}
+	default:
+		return fmt.Errorf("rule %s: unknown mode %s", r.Field, r.Mode)
+	}
+
+	if r.CSS != "" {
+		r.css, err = cascadia.Compile(r.CSS)
+		if err != nil {
+			return fmt.Errorf("rule %s: invalid css %s: %v", r.Field, r.CSS, err)
+		}
+
+		return nil
+	}
+
+	r.xpath, err = xpath.Compile(r.XPath)
+	if err != nil {
+		return fmt.Errorf("rule %s: invalid xpath %s: %v", r.Field, r.XPath, err)
+	}
+
+	return nil
+}
+
+// matchingRuleSets returns the rule sets matching the url
+func matchingRuleSets(sets []*RuleSet, u string) (matched []*RuleSet) {
+	for _, rs := range sets {
+		if rs.url == nil || rs.url.MatchString(u) {
+			matched = append(matched, rs)
+		}
+	}
+
+	return matched
+}
+
+// nodeValue returns the value of the node as per the mode of the rule
+func nodeValue(r *Rule, n *html.Node) string {
+	switch r.Mode {
+	case ExtractHTML:
+		return htmlquery.OutputHTML(n, true)
+	case ExtractAttr:
+		return htmlquery.SelectAttr(n, r.Attr)
+	}
+
+	return strings.TrimSpace(htmlquery.InnerText(n))
+}
+
+// applyRule returns the value extracted by the rule from the document. nil if nothing matched
+func applyRule(r *Rule, doc *html.Node) interface{} {
+	var nodes []*html.Node
+	if r.css != nil {
+		nodes = r.css.MatchAll(doc)
+	} else {
+		nodes = htmlquery.QuerySelectorAll(doc, r.xpath)
+	}
+
+	if len(nodes) < 1 {
+		return nil
+	}
+
+	if !r.Multiple {
+		return nodeValue(r, nodes[0])
+	}
+
+	var values []string
+	for _, n := range nodes {
+		values = append(values, nodeValue(r, n))
+	}
+
+	return values
+}
+
+// extractRecord applies the rule sets matching the url to the body. nil if no rule set matched or nothing is extracted
+func extractRecord(sets []*RuleSet, u string, body []byte) Record {
+	matched := matchingRuleSets(sets, u)
+	if len(matched) < 1 {
+		return nil
+	}
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+
+	rec := make(Record)
+	for _, rs := range matched {
+		for _, r := range rs.Rules {
+			if v := applyRule(r, doc); v != nil {
+				rec[r.Field] = v
+			}
+		}
+	}
+
+	if len(rec) < 1 {
+		return nil
+	}
+
+	return rec
+}
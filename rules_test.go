@@ -0,0 +1,138 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRulesYAML = `
+- rules:
+    - field: title
+      css: title
+- url: /product/
+  rules:
+    - field: name
+      xpath: //h1[@class="name"]
+    - field: price
+      css: span.price
+    - field: images
+      css: img.product
+      mode: attr
+      attr: src
+      multiple: true
+    - field: description
+      css: div.desc
+      mode: html
+    - field: missing
+      css: p.missing
+`
+
+const testProductHTML = `<html><head><title> Product One </title></head><body>
+<h1 class="name">One</h1>
+<span class="price">$10</span>
+<img class="product" src="/1.png"><img class="product" src="/2.png"><img src="/logo.png">
+<div class="desc"><b>Great</b></div>
+</body></html>`
+
+func TestParseRules(t *testing.T) {
+	sets, err := ParseRules(strings.NewReader(testRulesYAML))
+	if err != nil {
+		t.Fatalf("failed to parse rules: %v", err)
+	}
+
+	if len(sets) != 2 || len(sets[1].Rules) != 5 || sets[1].Rules[0].Mode != ExtractText {
+		t.Fatalf("unexpected rule sets: %+v", sets)
+	}
+
+	invalid := []string{
+		`- rules: [{css: h1}]`,
+		`- rules: [{field: a}]`,
+		`- rules: [{field: a, css: h1, xpath: //h1}]`,
+		`- rules: [{field: a, css: "h1["}]`,
+		`- rules: [{field: a, xpath: "//h1["}]`,
+		`- rules: [{field: a, css: h1, mode: attr}]`,
+		`- rules: [{field: a, css: h1, mode: json}]`,
+		`- {url: "[", rules: [{field: a, css: h1}]}`,
+		`rules: not a list`,
+	}
+
+	for _, r := range invalid {
+		if _, err := ParseRules(strings.NewReader(r)); err == nil {
+			t.Fatalf("expected error for %s", r)
+		}
+	}
+}
+
+func Test_extractRecord(t *testing.T) {
+	sets, _ := ParseRules(strings.NewReader(testRulesYAML))
+	tests := []struct {
+		url      string
+		expected Record
+	}{
+		{
+			url: "http://test.com/product/1",
+			expected: Record{
+				"title":       "Product One",
+				"name":        "One",
+				"price":       "$10",
+				"images":      []string{"/1.png", "/2.png"},
+				"description": `<div class="desc"><b>Great</b></div>`,
+			},
+		},
+
+		{
+			url:      "http://test.com/about",
+			expected: Record{"title": "Product One"},
+		},
+	}
+
+	for _, c := range tests {
+		r := extractRecord(sets, c.url, []byte(testProductHTML))
+		if !reflect.DeepEqual(r, c.expected) {
+			t.Fatalf("expected %v but got %v", c.expected, r)
+		}
+	}
+
+	if r := extractRecord(sets[1:], "http://test.com/about", []byte(testProductHTML)); r != nil {
+		t.Fatalf("expected no record but got %v", r)
+	}
+}
+
+func TestCrawler_RunRules(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<title>Home</title><a href="/product/1">one</a>`)
+			return
+		}
+
+		fmt.Fprint(w, testProductHTML)
+	}))
+	defer ts.Close()
+
+	sets, _ := ParseRules(strings.NewReader(testRulesYAML))
+	var records []Record
+	hooks := Hooks{OnPage: func(p *Page) { records = append(records, p.Record) }}
+	resp, err := New(WithIgnoreRobots(true), WithRules(sets...), WithHooks(hooks), WithRetainBodies(false)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(records) != 2 || len(resp.Records) != 2 {
+		t.Fatalf("expected 2 records but got %v %v", records, resp.Records)
+	}
+
+	if resp.Records[ts.URL+"/"]["title"] != "Home" || resp.Records[ts.URL+"/product/1"]["price"] != "$10" {
+		t.Fatalf("unexpected records: %v", resp.Records)
+	}
+
+	_, err = New(WithRules(&RuleSet{Rules: []*Rule{{Field: "a"}}})).Run(context.Background(), ts.URL+"/")
+	if err == nil {
+		t.Fatal("expected error for invalid rules")
+	}
+}
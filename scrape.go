@@ -6,21 +6,90 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
-	"runtime"
 	"sort"
 	"strings"
+	"time"
 )
 
 // Response holds the scrapped response
 type Response struct {
-	BaseURL      *url.URL            // starting url at maxDepth 0
-	UniqueURLs   map[string]int      // UniqueURLs holds the map of unique urls we crawled and times its repeated
-	URLsPerDepth map[int][]*url.URL  // URLsPerDepth holds url found in each depth
-	SkippedURLs  map[string][]string // SkippedURLs holds urls from different domains(if domainRegex is given) and invalid URLs
-	ErrorURLs    map[string]error    // errorURLs holds details as to why reason this url was not crawled
-	DomainRegex  *regexp.Regexp      // restricts crawling the urls to given domain
-	MaxDepth     int                 // MaxDepth of crawl, -1 means no limit for maxDepth
-	Interrupted  bool                // says if gru was interrupted while scraping
+	BaseURL        *url.URL                  // starting url at maxDepth 0
+	Seeds          []*url.URL                // Seeds the crawl started from at depth 0, BaseURL being the first
+	UniqueURLs     map[string]int            // UniqueURLs holds the map of unique urls we crawled and times its repeated
+	URLsPerDepth   map[int][]*url.URL        // URLsPerDepth holds url found in each depth
+	SkippedURLs    map[string][]string       // SkippedURLs holds urls from different domains(if domainRegex is given) and invalid URLs
+	ErrorURLs      map[string]error          // errorURLs holds details as to why reason this url was not crawled
+	DisallowedURLs map[string]string         // DisallowedURLs holds urls disallowed by robots.txt and the rule disallowing them
+	Attempts       map[string][]Attempt      // Attempts holds the fetch attempts of urls that failed transiently at least once
+	Links          []Link                    // Links holds the edges from crawled pages to the urls they link to
+	CheckedURLs    map[string]*LinkCheck     // CheckedURLs holds the results of urls checked without crawling them
+	Redirects      map[string][]Redirect     // Redirects holds the redirect chains of the urls that redirected
+	FilteredURLs   map[string]string         // FilteredURLs holds the urls excluded by the url rules and the rule excluding them
+	LimitedURLs    map[string]SkipReason     // LimitedURLs holds the urls dropped by the limits and the limit they broke
+	Records        map[string]Record         // Records holds the fields extracted from the pages by the rules
+	Marks          map[string][]string       // Marks holds the marks added to the urls by the processors
+	LastMod        map[string]time.Time      // LastMod holds the Last-Modified of the crawled pages and the lastmod of the urls listed in the sitemaps
+	Relations      map[string]*PageRelations // Relations holds the canonical, next, prev and alternate urls declared by the crawled pages
+	Pages          map[string]PageInfo       // Pages holds the html pages crawled with 200 OK
+	DomainRegex    *regexp.Regexp            // restricts crawling the urls to given domain
+	MaxDepth       int                       // MaxDepth of crawl, -1 means no limit for maxDepth
+	Interrupted    bool                      // says if gru was interrupted while scraping
+}
+
+// PageInfo is what the crawl records about an html page crawled with 200 OK
+type PageInfo struct {
+	Noindex bool // Noindex is true if the page asks not to be indexed through meta robots or X-Robots-Tag
+}
+
+// Link is an edge from a crawled page to the url it links to
+type Link struct {
+	Source string   // Source is the page the link is found in
+	Target string   // Target is the url the link points to
+	Kind   LinkKind // Kind of the link
+	Text   string   // Text of the anchor
+	Tag    string   // Tag the link is found in
+	Attr   string   // Attr of the tag holding the link
+	Rel    string   // Rel attribute of the tag, such as nofollow
+}
+
+// newLink returns the link from the source url to the extracted link
+func newLink(source string, l *extractedLink) Link {
+	return Link{
+		Source: source,
+		Target: l.url.String(),
+		Kind:   l.kind,
+		Text:   l.text,
+		Tag:    l.tag,
+		Attr:   l.attr,
+		Rel:    l.rel,
+	}
+}
+
+// Referrers returns the links pointing to the given url
+func (r Response) Referrers(u string) (links []Link) {
+	for _, l := range r.Links {
+		if l.Target == u {
+			links = append(links, l)
+		}
+	}
+
+	return links
+}
+
+// Outlinks returns the links found in the given url's page
+func (r Response) Outlinks(u string) (links []Link) {
+	for _, l := range r.Links {
+		if l.Source == u {
+			links = append(links, l)
+		}
+	}
+
+	return links
+}
+
+// BrokenLinks returns the links pointing to the urls that failed to crawl or failed the check
+func (r Response) BrokenLinks() []Link {
+	return brokenLinks(r)
 }
 
 // String returns a human readable format of the response
@@ -28,6 +97,9 @@ func (r Response) String() string {
 	var buffer bytes.Buffer
 	buffer.WriteString(strings.Repeat("=", 10) + "\n")
 	buffer.WriteString(fmt.Sprintf("Scrape stats for: %s\n", r.BaseURL))
+	if len(r.Seeds) > 1 {
+		buffer.WriteString(fmt.Sprintf("Seeds: %s\n", strings.Join(urlsToStr(r.Seeds), " ")))
+	}
 	buffer.WriteString(fmt.Sprintf("Max Depth: %d  Regex: %s  Interrupted: %t\n", r.MaxDepth, r.DomainRegex, r.Interrupted))
 	buffer.WriteString(strings.Repeat("=", 10) + "\n")
 	if len(r.UniqueURLs) < 1 {
@@ -77,12 +149,82 @@ func (r Response) String() string {
 		buffer.WriteString(strings.Repeat("-", 10) + "\n")
 	}
 
+	if len(r.DisallowedURLs) > 0 {
+		buffer.WriteString("\n")
+		buffer.WriteString("Disallowed URLs:\n")
+		buffer.WriteString(strings.Repeat("-", 10) + "\n")
+		for u, rule := range r.DisallowedURLs {
+			buffer.WriteString(u + " (" + rule + ")\n")
+		}
+		buffer.WriteString(strings.Repeat("-", 10) + "\n")
+	}
+
+	if len(r.LimitedURLs) > 0 {
+		buffer.WriteString("\n")
+		buffer.WriteString("Limited URLs:\n")
+		buffer.WriteString(strings.Repeat("-", 10) + "\n")
+		for u, reason := range r.LimitedURLs {
+			buffer.WriteString(u + " (" + string(reason) + ")\n")
+		}
+		buffer.WriteString(strings.Repeat("-", 10) + "\n")
+	}
+
+	if len(r.Redirects) > 0 {
+		buffer.WriteString("\n")
+		buffer.WriteString("Redirected URLs:\n")
+		buffer.WriteString(strings.Repeat("-", 10) + "\n")
+		for u, redirects := range r.Redirects {
+			buffer.WriteString(u + "\n")
+			for _, rd := range redirects {
+				buffer.WriteString(fmt.Sprintf("    %d -> %s\n", rd.StatusCode, rd.To))
+			}
+		}
+		buffer.WriteString(strings.Repeat("-", 10) + "\n")
+	}
+
+	if len(r.Attempts) > 0 {
+		buffer.WriteString("\n")
+		buffer.WriteString("Retried URLs:\n")
+		buffer.WriteString(strings.Repeat("-", 10) + "\n")
+		for u, attempts := range r.Attempts {
+			status := "failed"
+			if attempts[len(attempts)-1].Err == nil {
+				status = "succeeded"
+			}
+			buffer.WriteString(fmt.Sprintf("%s (%s after %d attempts)\n", u, status, len(attempts)))
+		}
+		buffer.WriteString(strings.Repeat("-", 10) + "\n")
+	}
+
+	if len(r.CheckedURLs) > 0 {
+		buffer.WriteString("\n")
+		buffer.WriteString("Checked URLs:\n")
+		buffer.WriteString(strings.Repeat("-", 10) + "\n")
+		for u, lc := range r.CheckedURLs {
+			buffer.WriteString(fmt.Sprintf("%s (status: %d latency: %v)\n", u, lc.StatusCode, lc.Latency))
+			if lc.RedirectURL != "" {
+				buffer.WriteString("    redirected to " + lc.RedirectURL + "\n")
+			}
+
+			if lc.Broken() {
+				buffer.WriteString(fmt.Sprintf("    broken: %v\n", lc.Err))
+				for _, l := range r.Referrers(u) {
+					buffer.WriteString("    referred by " + l.Source + "\n")
+				}
+			}
+		}
+		buffer.WriteString(strings.Repeat("-", 10) + "\n")
+	}
+
 	if len(r.ErrorURLs) > 0 {
 		buffer.WriteString("\n")
 		buffer.WriteString("Failed URLs:\n")
 		buffer.WriteString(strings.Repeat("-", 10) + "\n")
 		for u := range r.ErrorURLs {
 			buffer.WriteString(u + "\n")
+			for _, l := range r.Referrers(u) {
+				buffer.WriteString("    referred by " + l.Source + "\n")
+			}
 		}
 		buffer.WriteString(strings.Repeat("-", 10) + "\n")
 	}
@@ -93,63 +235,51 @@ func (r Response) String() string {
 // gruToResponse will convert gru data to response
 func gruToResponse(g *gru) *Response {
 	return &Response{
-		BaseURL:      g.baseURL,
-		UniqueURLs:   g.scrappedUnique,
-		URLsPerDepth: g.scrapped,
-		SkippedURLs:  g.skippedURLs,
-		ErrorURLs:    g.errorURLs,
-		DomainRegex:  g.domainRegex,
-		MaxDepth:     g.maxDepth,
-		Interrupted:  g.interrupted,
-	}
-}
-
-// start will start the scrapping
-func start(ctx context.Context, u string, maxDepth int, regex string) (resp *Response, err error) {
-	baseURL, err := url.Parse(u)
-	if err != nil {
-		return nil, fmt.Errorf("failed to scrape url: %v\n", err)
-	}
-
-	g := newGru(baseURL, maxDepth)
-	if regex != "" {
-		setDomainRegex(g, regex)
+		BaseURL:        g.baseURL,
+		Seeds:          g.seeds,
+		LastMod:        g.lastMod,
+		Pages:          g.pages,
+		UniqueURLs:     g.scrappedUnique,
+		URLsPerDepth:   g.scrapped,
+		SkippedURLs:    g.skippedURLs,
+		ErrorURLs:      g.errorURLs,
+		DisallowedURLs: g.disallowedURLs,
+		Attempts:       g.attempts,
+		Links:          g.links,
+		Relations:      g.relations,
+		Marks:          g.marks,
+		Records:        g.records,
+		FilteredURLs:   g.filteredURLs,
+		LimitedURLs:    g.limitedURLs,
+		Redirects:      g.redirects,
+		CheckedURLs:    g.checkedURLs,
+		DomainRegex:    g.domainRegex,
+		MaxDepth:       g.maxDepth,
+		Interrupted:    g.interrupted,
 	}
-
-	var minions []*minion
-	for i := 0; i < runtime.NumCPU()*2; i++ {
-		m := newMinion(fmt.Sprintf("Minion %d", i), g.submitDumpCh)
-		minions = append(minions, m)
-		go startMinion(ctx, m)
-
-	}
-
-	g.minions = minions
-	startGru(ctx, g)
-	return gruToResponse(g), nil
 }
 
 // StartWithDepth will start the scrapping with given max depth and base url domain
 func StartWithDepth(ctx context.Context, url string, maxDepth int) (resp *Response, err error) {
-	return start(ctx, url, maxDepth, "")
+	return New(WithMaxDepth(maxDepth)).Run(ctx, url)
 }
 
 // StartWithDepthAndDomainRegex will start the scrapping with max depth and regex
 func StartWithDepthAndDomainRegex(ctx context.Context, url string, maxDepth int, domainRegex string) (resp *Response, err error) {
-	return start(ctx, url, maxDepth, domainRegex)
+	return New(WithMaxDepth(maxDepth), WithDomainRegex(domainRegex)).Run(ctx, url)
 }
 
 // StartWithDomainRegex will start the scrapping with no depth limit(-1) and regex
 func StartWithDomainRegex(ctx context.Context, url, domainRegex string) (resp *Response, err error) {
-	return start(ctx, url, -1, domainRegex)
+	return New(WithDomainRegex(domainRegex)).Run(ctx, url)
 }
 
 // Start will start the scrapping with no depth limit(-1) and base url domain
 func Start(ctx context.Context, url string) (resp *Response, err error) {
-	return start(ctx, url, -1, "")
+	return New().Run(ctx, url)
 }
 
 // Sitemap generates a sitemap from the given response
 func Sitemap(resp *Response, file string) error {
-	return generateSiteMap(file, resp.UniqueURLs)
+	return (&SitemapWriter{File: file}).Write(resp)
 }
@@ -0,0 +1,251 @@
+package scrape
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxSitemapNesting is the max levels of sitemap indexes followed
+const maxSitemapNesting = 3
+
+// lastModLayouts are the W3C datetime layouts lastmod is written in
+var lastModLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+}
+
+// ReadSeeds reads the seed urls from r, one per line. empty lines and lines starting with # are skipped
+func ReadSeeds(r io.Reader) (seeds []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		seeds = append(seeds, line)
+	}
+
+	return seeds, scanner.Err()
+}
+
+// parseSeeds parses and normalizes the seeds dropping the duplicates
+func parseSeeds(n Normalizer, seeds []string) ([]*url.URL, error) {
+	var urls []*url.URL
+	seen := make(map[string]bool)
+	for _, s := range seeds {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scrape url: %v", err)
+		}
+
+		if n != nil {
+			u = n.Normalize(u)
+		}
+
+		if seen[u.String()] {
+			continue
+		}
+
+		seen[u.String()] = true
+		urls = append(urls, u)
+	}
+
+	if len(urls) < 1 {
+		return nil, fmt.Errorf("no seed urls to scrape")
+	}
+
+	return urls, nil
+}
+
+// seedsDomainRegex returns the default domain regex matching the hosts of the seeds
+func seedsDomainRegex(seeds []*url.URL) string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, u := range seeds {
+		if seen[u.Hostname()] {
+			continue
+		}
+
+		seen[u.Hostname()] = true
+		hosts = append(hosts, u.Hostname())
+	}
+
+	return strings.Join(hosts, "|")
+}
+
+// sitemapEntry is an url or a sitemap listed in a sitemap
+type sitemapEntry struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+// sitemapDoc is either a urlset or a sitemapindex
+type sitemapDoc struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+// sitemapURL is an url listed in a sitemap
+type sitemapURL struct {
+	u       *url.URL  // u is the url listed
+	lastMod time.Time // lastMod of the url. zero if not listed
+}
+
+// parseLastMod parses the W3C datetime of lastmod. zero time if invalid
+func parseLastMod(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range lastModLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// parseSitemap parses the sitemap or sitemap index from r. gzipped sitemaps are decompressed
+func parseSitemap(r io.Reader) (*sitemapDoc, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+
+		r = gr
+	} else {
+		r = br
+	}
+
+	var doc sitemapDoc
+	err := xml.NewDecoder(io.LimitReader(r, maxSitemapSize)).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch doc.XMLName.Local {
+	case "urlset", "sitemapindex":
+		return &doc, nil
+	}
+
+	return nil, fmt.Errorf("unknown sitemap root %s", doc.XMLName.Local)
+}
+
+// fetchSitemap fetches and parses the sitemap
+func fetchSitemap(client *http.Client, u string) (*sitemapDoc, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{URL: u, Code: resp.StatusCode}
+	}
+
+	return parseSitemap(resp.Body)
+}
+
+// sitemapsOf returns the sitemaps of the seed host listed in robots.txt, falling back to /sitemap.xml
+func sitemapsOf(client *http.Client, rc *robotsCache, userAgent string, seed *url.URL) []string {
+	var rules *robotsRules
+	if rc != nil {
+		rules = robotsForURL(rc, seed).rules
+	} else {
+		rules = fetchRobots(client, userAgent, seed)
+	}
+
+	if len(rules.sitemaps) > 0 {
+		return rules.sitemaps
+	}
+
+	return []string{(&url.URL{Scheme: seed.Scheme, Host: seed.Host, Path: "/sitemap.xml"}).String()}
+}
+
+// readSitemaps returns the urls listed in the sitemaps, following the sitemap indexes.
+// sitemaps failing to fetch or parse are logged and skipped
+func readSitemaps(client *http.Client, sitemaps []string) (urls []sitemapURL) {
+	seen := make(map[string]bool)
+	for level := 0; level < maxSitemapNesting && len(sitemaps) > 0; level++ {
+		var nested []string
+		for _, sm := range sitemaps {
+			if seen[sm] {
+				continue
+			}
+
+			seen[sm] = true
+			doc, err := fetchSitemap(client, sm)
+			if err != nil {
+				log.Printf("failed to read sitemap %s: %v\n", sm, err)
+				continue
+			}
+
+			for _, e := range doc.Sitemaps {
+				nested = append(nested, strings.TrimSpace(e.Loc))
+			}
+
+			for _, e := range doc.URLs {
+				u, err := url.Parse(strings.TrimSpace(e.Loc))
+				if err != nil || !u.IsAbs() {
+					continue
+				}
+
+				urls = append(urls, sitemapURL{u: u, lastMod: parseLastMod(e.LastMod)})
+			}
+		}
+
+		sitemaps = nested
+	}
+
+	return urls
+}
+
+// seedSitemaps queues the urls listed in the sitemaps of the seed hosts at depth 0 and records their lastmod.
+// urls failing the domain regex are skipped
+func seedSitemaps(g *gru, cfg *crawlConfig, userAgent string) {
+	hosts := make(map[string]bool)
+	var sitemaps []string
+	for _, s := range g.seeds {
+		if hosts[s.Scheme+"://"+s.Host] {
+			continue
+		}
+
+		hosts[s.Scheme+"://"+s.Host] = true
+		sitemaps = append(sitemaps, sitemapsOf(cfg.client, cfg.robots, userAgent, s)...)
+	}
+
+	for _, su := range readSitemaps(cfg.client, sitemaps) {
+		u := su.u
+		if cfg.normalizer != nil {
+			u = cfg.normalizer.Normalize(u)
+		}
+
+		if !g.domainRegex.MatchString(u.Hostname()) {
+			continue
+		}
+
+		if !su.lastMod.IsZero() {
+			g.lastMod[u.String()] = su.lastMod
+		}
+
+		g.sitemapSeeds = append(g.sitemapSeeds, u)
+	}
+
+	log.Printf("found %d urls in %d sitemaps\n", len(g.sitemapSeeds), len(sitemaps))
+}
@@ -0,0 +1,108 @@
+package scrape
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadSeeds(t *testing.T) {
+	seeds, err := ReadSeeds(strings.NewReader("https://a.com/\n\n# comment\n  https://b.com/  \n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(seeds, []string{"https://a.com/", "https://b.com/"}) {
+		t.Fatalf("unexpected seeds: %v", seeds)
+	}
+}
+
+func Test_parseSitemap(t *testing.T) {
+	urlset := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>https://a.com/?a=1&amp;b=2</loc><lastmod>2020-01-02</lastmod></url>
+	<url><loc> https://a.com/b </loc><lastmod>2020-01-02T10:20:30+05:30</lastmod></url>
+</urlset>`
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(urlset))
+	w.Close()
+
+	for _, data := range []string{urlset, gz.String()} {
+		doc, err := parseSitemap(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(doc.URLs) != 2 || doc.URLs[0].Loc != "https://a.com/?a=1&b=2" || parseLastMod(doc.URLs[1].LastMod).IsZero() {
+			t.Fatalf("unexpected sitemap: %+v", doc)
+		}
+	}
+
+	doc, err := parseSitemap(strings.NewReader(`<sitemapindex><sitemap><loc>https://a.com/1.xml</loc></sitemap></sitemapindex>`))
+	if err != nil || len(doc.Sitemaps) != 1 || doc.Sitemaps[0].Loc != "https://a.com/1.xml" {
+		t.Fatalf("unexpected sitemap index %+v: %v", doc, err)
+	}
+
+	if _, err := parseSitemap(strings.NewReader(`<html></html>`)); err == nil {
+		t.Fatal("expected error for unknown root")
+	}
+
+	expected := time.Date(2020, 1, 2, 4, 50, 30, 0, time.UTC)
+	if lm := parseLastMod("2020-01-02T10:20:30+05:30"); !lm.Equal(expected) {
+		t.Fatalf("expected %v but got %v", expected, lm)
+	}
+}
+
+func TestCrawler_RunSeeds(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nSitemap: %s/sitemap_index.xml\n", ts.URL)
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/pages.xml</loc></sitemap></sitemapindex>`, ts.URL)
+		case "/pages.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/hidden</loc><lastmod>2020-01-02</lastmod></url>`+
+				`<url><loc>http://example.com/</loc></url></urlset>`, ts.URL)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/">home</a>`)
+		}
+	}))
+	defer ts.Close()
+
+	resp, err := New(WithMaxDepth(1)).Run(context.Background(), ts.URL+"/", ts.URL+"/docs", ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resp.BaseURL.String() != ts.URL+"/" || len(resp.Seeds) != 2 || len(resp.UniqueURLs) != 2 {
+		t.Fatalf("expected both seeds to be crawled but got %v %v", resp.Seeds, resp.UniqueURLs)
+	}
+
+	resp, err = New(WithMaxDepth(1), WithSitemapSeeds(true)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := resp.UniqueURLs[ts.URL+"/hidden"]; !ok || len(resp.UniqueURLs) != 2 {
+		t.Fatalf("expected sitemap url to be crawled but got %v", resp.UniqueURLs)
+	}
+
+	if lm := resp.LastMod[ts.URL+"/hidden"]; !lm.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected lastmod %v", resp.LastMod)
+	}
+
+	if _, err := New().Run(context.Background()); err == nil {
+		t.Fatal("expected error without seeds")
+	}
+}
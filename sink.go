@@ -0,0 +1,32 @@
+package scrape
+
+import (
+	"fmt"
+	"io"
+)
+
+// Sink receives the response once the crawl is done
+type Sink interface {
+	Write(resp *Response) error
+}
+
+// SinkFunc defines the sink func type
+type SinkFunc func(resp *Response) error
+
+// Write acts a proxy to underlying sink
+func (sf SinkFunc) Write(resp *Response) error {
+	return sf(resp)
+}
+
+// WriterSink writes the human readable format of the response to w
+func WriterSink(w io.Writer) Sink {
+	return SinkFunc(func(resp *Response) error {
+		_, err := fmt.Fprint(w, resp)
+		return err
+	})
+}
+
+// SitemapSink generates a sitemap from the response into file. use a SitemapWriter to configure the sitemap
+func SitemapSink(file string) Sink {
+	return &SitemapWriter{File: file}
+}
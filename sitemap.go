@@ -1,44 +1,438 @@
 package scrape
 
-import "os"
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
-// generateSiteMap will write the crawled url to given file
-func generateSiteMap(fileName string, urls map[string]int) error {
-	err := deleteFileIfExists(fileName)
+const (
+	// sitemapNamespace is the xml namespace of the sitemaps and sitemap indexes
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+	// maxSitemapURLs is the max urls listed in a single sitemap as per the sitemaps protocol
+	maxSitemapURLs = 50000
+
+	// maxSitemapSize is the max bytes of a single sitemap, uncompressed, as per the sitemaps protocol
+	maxSitemapSize = 50 << 20
+)
+
+// SitemapPriority is how the priority of the urls listed in the sitemap is computed
+type SitemapPriority string
+
+// Priorities of the sitemap urls
+const (
+	PriorityDepth   SitemapPriority = "depth"   // 1.0 for the seeds, 0.2 less per depth down to 0.1. 0.1 if the depth is unknown
+	PriorityInlinks SitemapPriority = "inlinks" // 0.1 to 1.0 by the pages linking to the url against the most linked url
+)
+
+// changeFreqs are the valid changefreq values
+var changeFreqs = map[string]bool{
+	"always":  true,
+	"hourly":  true,
+	"daily":   true,
+	"weekly":  true,
+	"monthly": true,
+	"yearly":  true,
+	"never":   true,
+}
+
+// ChangeFreqRule sets the changefreq of the sitemap urls matching the rule
+type ChangeFreqRule struct {
+	Rule *URLRule // Rule matching the urls. Exclude is ignored
+	Freq string   // Freq is always, hourly, daily, weekly, monthly, yearly or never
+}
+
+// ChangeFreq returns a rule setting freq to the urls matching the spec.
+// spec is [url:|path:|query:][glob:]pattern, such as path:glob:/blog/**
+func ChangeFreq(spec, freq string) (*ChangeFreqRule, error) {
+	r, err := Include(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	cr := &ChangeFreqRule{Rule: r, Freq: freq}
+	return cr, compileChangeFreqRule(cr)
+}
+
+// compileChangeFreqRule validates the freq and compiles the rule
+func compileChangeFreqRule(cr *ChangeFreqRule) error {
+	if cr.Rule == nil {
+		return fmt.Errorf("changefreq %s without url rule", cr.Freq)
+	}
+
+	if !changeFreqs[cr.Freq] {
+		return fmt.Errorf("unknown changefreq %s", cr.Freq)
+	}
+
+	return compileURLRule(cr.Rule)
+}
+
+// SitemapWriter writes the crawled urls to File as per the sitemaps.org protocol, sorted by url.
+// urls beyond the limits of a single sitemap are split into numbered sitemaps next to File,
+// and File is written as the sitemap index listing them. Files ending with .gz are gzipped
+type SitemapWriter struct {
+	File           string            // File the sitemap, or the sitemap index if split, is written to
+	BaseURL        string            // BaseURL the sitemaps are served from, listed in the sitemap index. Defaults to the root of the response base url
+	MaxURLs        int               // MaxURLs listed in a single sitemap. Defaults to 50,000
+	MaxSize        int               // MaxSize of a single sitemap in bytes, uncompressed. Defaults to 50MB
+	CanonicalOnly  bool              // CanonicalOnly lists only the html pages crawled with 200 OK that are not canonicalized to another url
+	ExcludeNoindex bool              // ExcludeNoindex leaves out the pages asking not to be indexed
+	Priority       SitemapPriority   // Priority of the urls. priority is omitted if empty
+	ChangeFreqs    []*ChangeFreqRule // ChangeFreqs set the changefreq of the urls. first matching rule wins, omitted if none matches
+}
+
+// Write writes the sitemap of the urls crawled in the response. lastmod is filled from the response LastMod
+func (w *SitemapWriter) Write(resp *Response) error {
+	switch w.Priority {
+	case "", PriorityDepth, PriorityInlinks:
+	default:
+		return fmt.Errorf("unknown sitemap priority %s", w.Priority)
+	}
+
+	for _, cr := range w.ChangeFreqs {
+		err := compileChangeFreqRule(cr)
+		if err != nil {
+			return err
+		}
+	}
+
+	var entries []sitemapEntry
+	priority := sitemapPriorities(w.Priority, resp)
+	for _, loc := range sitemapLocs(w, resp) {
+		entries = append(entries, sitemapEntry{
+			Loc:        loc,
+			LastMod:    formatLastMod(resp.LastMod[loc]),
+			ChangeFreq: changeFreqOf(w.ChangeFreqs, loc),
+			Priority:   priority(loc),
+		})
+	}
+
+	maxURLs, maxSize := w.MaxURLs, w.MaxSize
+	if maxURLs < 1 || maxURLs > maxSitemapURLs {
+		maxURLs = maxSitemapURLs
+	}
+
+	if maxSize < 1 || maxSize > maxSitemapSize {
+		maxSize = maxSitemapSize
+	}
+
+	parts, err := splitSitemap("urlset", "url", entries, maxURLs, maxSize)
 	if err != nil {
 		return err
 	}
 
-	fh, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if len(parts) == 1 {
+		return writeSitemap(w.File, "urlset", parts[0].data)
+	}
+
+	base, err := sitemapBaseURL(w.BaseURL, resp.BaseURL)
 	if err != nil {
 		return err
 	}
-	defer fh.Close()
 
-	fh.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
-	fh.WriteString("<urlset xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">\n")
-	for loc := range urls {
-		fh.WriteString("    " + "<url>\n")
-		fh.WriteString("      " + "<loc>" + loc + "</loc>\n")
-		fh.WriteString("      " + "<changefreq>weekly</changefreq>\n")
-		fh.WriteString("      " + "<priority>0.5</priority>\n")
-		fh.WriteString("    " + "</url>\n")
+	var sitemaps []sitemapEntry
+	for i, p := range parts {
+		file := sitemapPartFile(w.File, i+1)
+		err := writeSitemap(file, "urlset", p.data)
+		if err != nil {
+			return err
+		}
+
+		loc := base.ResolveReference(&url.URL{Path: filepath.Base(file)})
+		sitemaps = append(sitemaps, sitemapEntry{Loc: loc.String(), LastMod: formatLastMod(p.lastMod)})
+	}
+
+	index, err := splitSitemap("sitemapindex", "sitemap", sitemaps, maxSitemapURLs, maxSitemapSize)
+	if err != nil {
+		return err
+	}
+
+	if len(index) > 1 {
+		return fmt.Errorf("sitemap index of %d sitemaps exceeds the protocol limits", len(sitemaps))
+	}
+
+	return writeSitemap(w.File, "sitemapindex", index[0].data)
+}
+
+// sitemapLocs returns the urls of the response to list in the sitemap, sorted
+func sitemapLocs(w *SitemapWriter, resp *Response) []string {
+	var locs []string
+	for loc := range resp.UniqueURLs {
+		p, crawled := resp.Pages[loc]
+		if w.ExcludeNoindex && p.Noindex {
+			continue
+		}
+
+		if w.CanonicalOnly {
+			if !crawled {
+				continue
+			}
+
+			if r := resp.Relations[loc]; r != nil && r.Canonical != "" && !sameURL(r.Canonical, loc) {
+				continue
+			}
+		}
+
+		locs = append(locs, loc)
+	}
+
+	sort.Strings(locs)
+	return locs
+}
+
+// sameURL says if the urls are the same once normalized
+func sameURL(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	return DefaultNormalizer.Normalize(ua).String() == DefaultNormalizer.Normalize(ub).String()
+}
+
+// changeFreqOf returns the changefreq of the first rule matching the url. empty if none matches
+func changeFreqOf(rules []*ChangeFreqRule, loc string) string {
+	if len(rules) < 1 {
+		return ""
+	}
+
+	u, err := url.Parse(loc)
+	if err != nil {
+		return ""
+	}
+
+	for _, cr := range rules {
+		if matchURLRule(cr.Rule, u) {
+			return cr.Freq
+		}
+	}
+
+	return ""
+}
+
+// sitemapPriorities returns the func formatting the priority of the urls in the response
+func sitemapPriorities(priority SitemapPriority, resp *Response) func(loc string) string {
+	format := func(p float64) string {
+		return strconv.FormatFloat(math.Max(0.1, math.Min(1, p)), 'f', 1, 64)
+	}
+
+	switch priority {
+	case PriorityDepth:
+		depths := make(map[string]int)
+		for d, urls := range resp.URLsPerDepth {
+			for _, u := range urls {
+				if od, ok := depths[u.String()]; !ok || d < od {
+					depths[u.String()] = d
+				}
+			}
+		}
+
+		return func(loc string) string {
+			d, ok := depths[loc]
+			if !ok {
+				return format(0.1)
+			}
+
+			return format(1 - 0.2*float64(d))
+		}
+	case PriorityInlinks:
+		sources := make(map[string]map[string]bool)
+		max := 0
+		for _, l := range resp.Links {
+			if l.Source == l.Target {
+				continue
+			}
+
+			if sources[l.Target] == nil {
+				sources[l.Target] = make(map[string]bool)
+			}
+
+			sources[l.Target][l.Source] = true
+			if len(sources[l.Target]) > max {
+				max = len(sources[l.Target])
+			}
+		}
+
+		return func(loc string) string {
+			if max == 0 {
+				return format(1)
+			}
+
+			return format(0.1 + 0.9*float64(len(sources[loc]))/float64(max))
+		}
+	}
+
+	return func(loc string) string {
+		return ""
+	}
+}
+
+// sitemapPart is the encoded entries of a single sitemap
+type sitemapPart struct {
+	data    [][]byte  // data holds the encoded entries
+	size    int       // size of the sitemap in bytes including the header and root
+	lastMod time.Time // lastMod is the latest lastmod of the entries
+}
+
+// formatLastMod formats t as W3C datetime. empty if t is zero
+func formatLastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
 	}
-	fh.WriteString("</urlset> ")
 
-	return nil
+	return t.UTC().Format(time.RFC3339)
+}
+
+// sitemapOpen returns the xml header and the opening root element of the sitemap
+func sitemapOpen(root string) string {
+	return fmt.Sprintf("%s<%s xmlns=\"%s\">\n", xml.Header, root, sitemapNamespace)
+}
 
+// sitemapClose returns the closing root element of the sitemap
+func sitemapClose(root string) string {
+	return fmt.Sprintf("</%s>\n", root)
 }
 
-//deleteFileIfExists deletes a file if exists
-func deleteFileIfExists(fileName string) error {
-	//delete old file first
-	if _, err := os.Stat(fileName); err == nil {
-		err := os.Remove(fileName)
+// encodeSitemapEntry encodes the entry as an indented xml element with name
+func encodeSitemapEntry(name string, e sitemapEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("  ", "  ")
+	err := enc.EncodeElement(e, xml.StartElement{Name: xml.Name{Local: name}})
+	if err != nil {
+		return nil, err
+	}
+
+	err = enc.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// splitSitemap encodes the entries and splits them into sitemaps of at most maxURLs entries and maxSize bytes.
+// returns a single empty sitemap if there are no entries
+func splitSitemap(root, name string, entries []sitemapEntry, maxURLs, maxSize int) ([]sitemapPart, error) {
+	empty := len(sitemapOpen(root)) + len(sitemapClose(root))
+	parts := []sitemapPart{{size: empty}}
+	for _, e := range entries {
+		data, err := encodeSitemapEntry(name, e)
+		if err != nil {
+			return nil, err
+		}
+
+		if empty+len(data) > maxSize {
+			return nil, fmt.Errorf("sitemap entry %s exceeds %d bytes", e.Loc, maxSize)
+		}
+
+		p := &parts[len(parts)-1]
+		if len(p.data) >= maxURLs || p.size+len(data) > maxSize {
+			parts = append(parts, sitemapPart{size: empty})
+			p = &parts[len(parts)-1]
+		}
+
+		p.data = append(p.data, data)
+		p.size += len(data)
+		if lm := parseLastMod(e.LastMod); lm.After(p.lastMod) {
+			p.lastMod = lm
+		}
+	}
+
+	return parts, nil
+}
+
+// sitemapBaseURL returns the url the sitemaps are served from. defaults to the root of the response base url
+func sitemapBaseURL(base string, respBase *url.URL) (*url.URL, error) {
+	if base == "" {
+		if respBase == nil {
+			return nil, fmt.Errorf("sitemap base url is required to write the sitemap index")
+		}
+
+		return &url.URL{Scheme: respBase.Scheme, Host: respBase.Host, Path: "/"}, nil
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sitemap base url: %v", err)
+	}
+
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+
+	return u, nil
+}
+
+// sitemapPartFile returns the file of the nth sitemap listed in the index written to file.
+// sitemap.xml.gz becomes sitemap-1.xml.gz
+func sitemapPartFile(file string, n int) string {
+	gz := ""
+	if strings.HasSuffix(file, ".gz") {
+		file, gz = strings.TrimSuffix(file, ".gz"), ".gz"
+	}
+
+	ext := filepath.Ext(file)
+	return fmt.Sprintf("%s-%d%s%s", strings.TrimSuffix(file, ext), n, ext, gz)
+}
+
+// writeSitemap writes the encoded entries under root to file, gzipped if the file ends with .gz
+func writeSitemap(file, root string, entries [][]byte) (err error) {
+	fh, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := fh.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	var w io.Writer = fh
+	if strings.HasSuffix(file, ".gz") {
+		gw := gzip.NewWriter(fh)
+		defer func() {
+			if cerr := gw.Close(); err == nil {
+				err = cerr
+			}
+		}()
+
+		w = gw
+	}
+
+	_, err = io.WriteString(w, sitemapOpen(root))
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		_, err = w.Write(e)
 		if err != nil {
 			return err
 		}
-		return nil
 	}
-	return nil
+
+	_, err = io.WriteString(w, sitemapClose(root))
+	return err
 }
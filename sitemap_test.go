@@ -0,0 +1,261 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_sitemapPartFile(t *testing.T) {
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{file: "sitemap.xml", expected: "sitemap-2.xml"},
+		{file: "out/sitemap.xml.gz", expected: "out/sitemap-2.xml.gz"},
+		{file: "sitemap", expected: "sitemap-2"},
+	}
+
+	for _, c := range tests {
+		if got := sitemapPartFile(c.file, 2); got != c.expected {
+			t.Fatalf("expected %s but got %s", c.expected, got)
+		}
+	}
+}
+
+func TestSitemapWriter_Write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sitemap")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	baseURL, _ := url.Parse("https://a.com/docs")
+	resp := &Response{
+		BaseURL: baseURL,
+		UniqueURLs: map[string]int{
+			"https://a.com/?a=1&b=<2>": 1,
+			"https://a.com/1":          1,
+			"https://a.com/2":          1,
+		},
+		LastMod: map[string]time.Time{
+			"https://a.com/1": time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+	}
+
+	file := filepath.Join(dir, "sitemap.xml")
+	if err := Sitemap(resp, file); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fh, _ := os.Open(file)
+	doc, err := parseSitemap(fh)
+	fh.Close()
+	if err != nil {
+		t.Fatalf("failed to parse the sitemap: %v", err)
+	}
+
+	lastMod := make(map[string]string)
+	for _, e := range doc.URLs {
+		lastMod[e.Loc] = e.LastMod
+	}
+
+	if len(lastMod) != 3 || lastMod["https://a.com/1"] != "2020-01-02T03:04:05Z" || lastMod["https://a.com/2"] != "" {
+		t.Fatalf("unexpected sitemap urls %v", lastMod)
+	}
+
+	if _, ok := lastMod["https://a.com/?a=1&b=<2>"]; !ok {
+		t.Fatalf("expected the escaped url to be listed: %v", lastMod)
+	}
+
+	// split into gzipped sitemaps listed in the index
+	file = filepath.Join(dir, "sitemap.xml.gz")
+	w := &SitemapWriter{File: file, MaxURLs: 2}
+	if err := w.Write(resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fh, _ = os.Open(file)
+	index, err := parseSitemap(fh)
+	fh.Close()
+	if err != nil {
+		t.Fatalf("failed to parse the sitemap index: %v", err)
+	}
+
+	expected := []string{"https://a.com/sitemap-1.xml.gz", "https://a.com/sitemap-2.xml.gz"}
+	if index.XMLName.Local != "sitemapindex" || len(index.Sitemaps) != 2 ||
+		index.Sitemaps[0].Loc != expected[0] || index.Sitemaps[1].Loc != expected[1] {
+		t.Fatalf("expected index of %v but got %+v", expected, index)
+	}
+
+	urls := 0
+	for i := 1; i <= 2; i++ {
+		fh, _ := os.Open(sitemapPartFile(file, i))
+		doc, err := parseSitemap(fh)
+		fh.Close()
+		if err != nil {
+			t.Fatalf("failed to parse the sitemap %d: %v", i, err)
+		}
+
+		urls += len(doc.URLs)
+	}
+
+	if urls != 3 {
+		t.Fatalf("expected 3 urls across the sitemaps but got %d", urls)
+	}
+
+	// entries are split by size too
+	w = &SitemapWriter{File: filepath.Join(dir, "small.xml"), BaseURL: "https://cdn.a.com/maps", MaxSize: 205}
+	if err := w.Write(resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := ioutil.ReadFile(w.File)
+	if !strings.Contains(string(data), "https://cdn.a.com/maps/small-3.xml") {
+		t.Fatalf("expected 3 sitemaps in the index but got %s", data)
+	}
+
+	w.MaxSize = 150
+	if err := w.Write(resp); err == nil {
+		t.Fatal("expected error for entries larger than max size")
+	}
+}
+
+func TestCrawler_RunSitemap(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Last-Modified", "Thu, 02 Jan 2020 03:04:05 GMT")
+			fmt.Fprint(w, `<a href="/blog/1">1</a><a href="/copy">copy</a><a href="/private">private</a>`+
+				`<a href="/hidden">hidden</a><a href="/missing">missing</a><a href="/file.pdf">pdf</a>`)
+		case "/blog/1":
+			fmt.Fprint(w, `<link rel="canonical" href="/blog/1"><a href="/">home</a><a href="/blog/2">2</a>`)
+		case "/blog/2":
+			fmt.Fprint(w, `<a href="/">home</a>`)
+		case "/copy":
+			fmt.Fprint(w, `<link rel="canonical" href="/blog/1">`)
+		case "/private":
+			fmt.Fprint(w, `<meta name="robots" content="noindex, follow">`)
+		case "/hidden":
+			w.Header().Set("X-Robots-Tag", "noarchive, noindex")
+		case "/file.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "sitemap")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "sitemap.xml")
+	resp, err := New(WithIgnoreRobots(true), WithSinks(SitemapSink(file))).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := ioutil.ReadFile(file)
+	expected := fmt.Sprintf("<url>\n    <loc>%s/</loc>\n    <lastmod>2020-01-02T03:04:05Z</lastmod>\n  </url>", ts.URL)
+	if !strings.Contains(string(data), expected) || !strings.Contains(string(data), ts.URL+"/file.pdf</loc>") ||
+		!strings.HasSuffix(string(data), "</urlset>\n") {
+		t.Fatalf("unexpected sitemap %s", data)
+	}
+
+	if !resp.Pages[ts.URL+"/private"].Noindex || !resp.Pages[ts.URL+"/hidden"].Noindex || resp.Pages[ts.URL+"/"].Noindex {
+		t.Fatalf("unexpected noindex pages %v", resp.Pages)
+	}
+
+	blog, _ := ChangeFreq("path:glob:/blog/**", "daily")
+	home, _ := ChangeFreq("path:^/$", "hourly")
+	tests := []struct {
+		w        *SitemapWriter
+		expected []sitemapEntry
+	}{
+		{
+			w: &SitemapWriter{CanonicalOnly: true, ExcludeNoindex: true, Priority: PriorityDepth, ChangeFreqs: []*ChangeFreqRule{blog, home}},
+			expected: []sitemapEntry{
+				{Loc: ts.URL + "/", LastMod: "2020-01-02T03:04:05Z", ChangeFreq: "hourly", Priority: "1.0"},
+				{Loc: ts.URL + "/blog/1", ChangeFreq: "daily", Priority: "0.8"},
+				{Loc: ts.URL + "/blog/2", ChangeFreq: "daily", Priority: "0.6"},
+			},
+		},
+
+		{
+			w: &SitemapWriter{CanonicalOnly: true, Priority: PriorityInlinks},
+			expected: []sitemapEntry{
+				{Loc: ts.URL + "/", LastMod: "2020-01-02T03:04:05Z", Priority: "1.0"},
+				{Loc: ts.URL + "/blog/1", Priority: "1.0"},
+				{Loc: ts.URL + "/blog/2", Priority: "0.6"},
+				{Loc: ts.URL + "/hidden", Priority: "0.6"},
+				{Loc: ts.URL + "/private", Priority: "0.6"},
+			},
+		},
+	}
+
+	for _, c := range tests {
+		c.w.File = file
+		if err := c.w.Write(resp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		fh, _ := os.Open(file)
+		doc, err := parseSitemap(fh)
+		fh.Close()
+		if err != nil {
+			t.Fatalf("failed to parse the sitemap: %v", err)
+		}
+
+		if fmt.Sprint(doc.URLs) != fmt.Sprint(c.expected) {
+			t.Fatalf("expected sitemap urls %v but got %v", c.expected, doc.URLs)
+		}
+	}
+
+	if err := (&SitemapWriter{File: file, Priority: "random"}).Write(resp); err == nil {
+		t.Fatal("expected error for unknown priority")
+	}
+
+	if _, err := ChangeFreq("path:/", "sometimes"); err == nil {
+		t.Fatal("expected error for unknown changefreq")
+	}
+}
+
+func TestCrawler_RunSitemapRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/old">old</a>`)
+	})
+	mux.Handle("/old", http.RedirectHandler("/new", http.StatusMovedPermanently))
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := New(WithIgnoreRobots(true)).Run(context.Background(), ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// final url is at the depth of the redirected url and urls of unknown depth get the lowest priority
+	priority := sitemapPriorities(PriorityDepth, resp)
+	expected := map[string]string{"/": "1.0", "/new": "0.8", "/unknown": "0.1"}
+	for u, p := range expected {
+		if got := priority(ts.URL + u); got != p {
+			t.Fatalf("expected priority %s for %s but got %s", p, u, got)
+		}
+	}
+}
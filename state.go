@@ -0,0 +1,402 @@
+package scrape
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"time"
+)
+
+// defaultCheckpointInterval is the interval the crawl state is saved at
+const defaultCheckpointInterval = 30 * time.Second
+
+// CrawlState is the snapshot of the crawl saved to resume the crawl later.
+// Errors are saved as their messages and are no longer typed once restored
+type CrawlState struct {
+	BaseURL        string                    // BaseURL the crawl started from
+	Seeds          []string                  // Seeds the crawl started from, BaseURL being the first
+	Frontier       map[int][]string          // Frontier holds the urls yet to be crawled per depth, including those in flight
+	Checks         map[int][]string          // Checks holds the urls yet to be checked per depth, including those in flight
+	UniqueURLs     map[string]int            // UniqueURLs crawled and times each url is repeated
+	URLsPerDepth   map[int][]string          // URLsPerDepth holds urls found in each depth
+	SkippedURLs    map[string][]string       // SkippedURLs holds urls failing domainRegex and invalid urls
+	ErrorURLs      map[string]string         // ErrorURLs holds the reason the url was not crawled
+	DisallowedURLs map[string]string         // DisallowedURLs holds urls disallowed by robots.txt and the rule disallowing them
+	CheckedURLs    map[string]CheckedURL     // CheckedURLs holds the results of urls checked without crawling them
+	Redirects      map[string][]Redirect     // Redirects holds the redirect chains of the urls that redirected
+	Relations      map[string]*PageRelations // Relations holds the relations declared by the crawled pages
+	Marks          map[string][]string       // Marks holds the marks added to the urls by the processors
+	Records        map[string]Record         // Records holds the fields extracted from the pages by the rules
+	FilteredURLs   map[string]string         // FilteredURLs holds the urls excluded by the url rules and the rule excluding them
+	LimitedURLs    map[string]SkipReason     // LimitedURLs holds the urls dropped by the limits and the limit they broke
+	LastMod        map[string]time.Time      // LastMod holds the Last-Modified of the crawled pages and the lastmod of the urls listed in the sitemaps
+	Pages          map[string]PageInfo       // Pages holds the html pages crawled with 200 OK
+	Links          []Link                    // Links holds the edges from crawled pages to the urls they link to
+	Attempts       map[string][]SavedAttempt // Attempts holds the fetch attempts of urls that failed transiently
+	Retries        []RetryURL                // Retries holds the urls waiting for their backoff to be retried
+	SavedAt        time.Time                 // SavedAt is the time the state is saved
+	Completed      bool                      // Completed is true if nothing is left to crawl. completed crawls are not resumed
+}
+
+// CheckedURL is the saved form of the LinkCheck
+type CheckedURL struct {
+	StatusCode  int           // StatusCode of the response
+	RedirectURL string        // RedirectURL is the final url if the url redirected
+	Latency     time.Duration // Latency of the check
+	Err         string        // Err is the reason the link is broken. empty if the link is fine
+}
+
+// SavedAttempt is the saved form of the Attempt
+type SavedAttempt struct {
+	At    time.Time     // At is the time attempt's result was processed
+	Err   string        // Err of the attempt. empty if the attempt succeeded
+	Retry time.Duration // Retry is the backoff before the next attempt. 0 if not retried
+}
+
+// RetryURL is the saved form of an url waiting for its backoff to be retried
+type RetryURL struct {
+	URL    string    // URL to retry
+	Depth  int       // Depth of the url
+	Source string    // Source is the page the url is found on
+	At     time.Time // At is the time after which the url can be retried
+}
+
+// StateStore saves the crawl state so that an interrupted or crashed crawl can be resumed
+type StateStore interface {
+	// Load returns the saved state. nil if there is none
+	Load() (*CrawlState, error)
+	// Save replaces the saved state with the given state
+	Save(state *CrawlState) error
+}
+
+// fileStore saves the state as json to a file
+type fileStore struct {
+	path string
+}
+
+// FileStore returns a StateStore saving the state to the file.
+// state is written to a temporary file first and renamed so that a crash never leaves a partial state behind
+func FileStore(path string) StateStore {
+	return &fileStore{path: path}
+}
+
+// Load reads the state from the file. nil if the file doesn't exist
+func (fs *fileStore) Load() (*CrawlState, error) {
+	f, err := os.Open(fs.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var s CrawlState
+	return &s, json.NewDecoder(f).Decode(&s)
+}
+
+// Save writes the state to the file
+func (fs *fileStore) Save(state *CrawlState) error {
+	tmp := fs.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	err = json.NewEncoder(f).Encode(state)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, fs.path)
+}
+
+// urlsPerDepthToStr converts the urls per depth to raw urls
+func urlsPerDepthToStr(urls map[int][]*url.URL) map[int][]string {
+	m := make(map[int][]string)
+	for d, us := range urls {
+		m[d] = append(m[d], urlsToStr(us)...)
+	}
+
+	return m
+}
+
+// strToURLsPerDepth converts the raw urls per depth to urls. invalid urls are dropped
+func strToURLsPerDepth(urls map[int][]string) map[int][]*url.URL {
+	m := make(map[int][]*url.URL)
+	for d, us := range urls {
+		for _, r := range us {
+			u, err := url.Parse(r)
+			if err != nil {
+				continue
+			}
+
+			m[d] = append(m[d], u)
+		}
+	}
+
+	return m
+}
+
+// snapshotState returns the current state of the crawl.
+// urls in flight are saved to the frontier so that they are crawled again on resume
+func snapshotState(g *gru) *CrawlState {
+	s := &CrawlState{
+		BaseURL:        g.baseURL.String(),
+		Seeds:          urlsToStr(g.seeds),
+		LastMod:        make(map[string]time.Time),
+		Pages:          make(map[string]PageInfo),
+		Frontier:       urlsPerDepthToStr(frontierURLs(g.unScrapped)),
+		Checks:         urlsPerDepthToStr(frontierURLs(g.unChecked)),
+		UniqueURLs:     make(map[string]int),
+		URLsPerDepth:   urlsPerDepthToStr(g.scrapped),
+		SkippedURLs:    make(map[string][]string),
+		ErrorURLs:      make(map[string]string),
+		DisallowedURLs: make(map[string]string),
+		CheckedURLs:    make(map[string]CheckedURL),
+		Redirects:      make(map[string][]Redirect),
+		Relations:      make(map[string]*PageRelations),
+		Marks:          make(map[string][]string),
+		Records:        make(map[string]Record),
+		FilteredURLs:   make(map[string]string),
+		LimitedURLs:    make(map[string]SkipReason),
+		Links:          append([]Link(nil), g.links...),
+		Attempts:       make(map[string][]SavedAttempt),
+		SavedAt:        time.Now(),
+	}
+
+	s.Completed = g.unScrapped.Len() == 0 && g.unChecked.Len() == 0 && len(g.inFlight) == 0 && len(g.retryQueue) == 0
+
+	for u, f := range g.inFlight {
+		if f.check {
+			s.Checks[f.depth] = append(s.Checks[f.depth], u)
+			continue
+		}
+
+		s.Frontier[f.depth] = append(s.Frontier[f.depth], u)
+	}
+
+	for _, r := range g.retryQueue {
+		s.Retries = append(s.Retries, RetryURL{URL: r.u.String(), Depth: r.depth, Source: r.source, At: r.at})
+	}
+
+	for u, attempts := range g.attempts {
+		for _, a := range attempts {
+			sa := SavedAttempt{At: a.At, Retry: a.Retry}
+			if a.Err != nil {
+				sa.Err = a.Err.Error()
+			}
+
+			s.Attempts[u] = append(s.Attempts[u], sa)
+		}
+	}
+
+	for u, c := range g.scrappedUnique {
+		s.UniqueURLs[u] = c
+	}
+
+	for u, us := range g.skippedURLs {
+		s.SkippedURLs[u] = append([]string(nil), us...)
+	}
+
+	for u, err := range g.errorURLs {
+		s.ErrorURLs[u] = err.Error()
+	}
+
+	for u, rule := range g.disallowedURLs {
+		s.DisallowedURLs[u] = rule
+	}
+
+	for u, lc := range g.checkedURLs {
+		c := CheckedURL{StatusCode: lc.StatusCode, RedirectURL: lc.RedirectURL, Latency: lc.Latency}
+		if lc.Err != nil {
+			c.Err = lc.Err.Error()
+		}
+
+		s.CheckedURLs[u] = c
+	}
+
+	for u, rs := range g.redirects {
+		s.Redirects[u] = rs
+	}
+
+	for u, r := range g.relations {
+		s.Relations[u] = r
+	}
+
+	for u, ms := range g.marks {
+		s.Marks[u] = append([]string(nil), ms...)
+	}
+
+	for u, r := range g.records {
+		s.Records[u] = r
+	}
+
+	for u, rule := range g.filteredURLs {
+		s.FilteredURLs[u] = rule
+	}
+
+	for u, reason := range g.limitedURLs {
+		s.LimitedURLs[u] = reason
+	}
+
+	for u, t := range g.lastMod {
+		s.LastMod[u] = t
+	}
+
+	for u, p := range g.pages {
+		s.Pages[u] = p
+	}
+
+	return s
+}
+
+// restoreState restores the gru from the saved state
+func restoreState(g *gru, s *CrawlState) {
+	g.resumed = true
+	pushURLsPerDepth(g.unScrapped, strToURLsPerDepth(s.Frontier))
+	pushURLsPerDepth(g.unChecked, strToURLsPerDepth(s.Checks))
+	g.scrapped = strToURLsPerDepth(s.URLsPerDepth)
+	g.links = s.Links
+	for _, l := range s.Links {
+		g.inlinks[l.Target]++
+	}
+
+	for u, c := range s.UniqueURLs {
+		g.scrappedUnique[u] = c
+	}
+
+	for u, us := range s.SkippedURLs {
+		g.skippedURLs[u] = us
+	}
+
+	for u, msg := range s.ErrorURLs {
+		g.errorURLs[u] = errors.New(msg)
+	}
+
+	for u, rule := range s.DisallowedURLs {
+		g.disallowedURLs[u] = rule
+	}
+
+	for u, c := range s.CheckedURLs {
+		lc := &LinkCheck{URL: u, StatusCode: c.StatusCode, RedirectURL: c.RedirectURL, Latency: c.Latency}
+		if c.Err != "" {
+			lc.Err = errors.New(c.Err)
+		}
+
+		g.checkedURLs[u] = lc
+		g.checkQueued[u] = true
+	}
+
+	for _, us := range s.Checks {
+		for _, u := range us {
+			g.checkQueued[u] = true
+		}
+	}
+
+	for u, rs := range s.Redirects {
+		g.redirects[u] = rs
+	}
+
+	for u, r := range s.Relations {
+		g.relations[u] = r
+	}
+
+	for u, ms := range s.Marks {
+		g.marks[u] = ms
+	}
+
+	for u, r := range s.Records {
+		g.records[u] = r
+	}
+
+	for u, rule := range s.FilteredURLs {
+		g.filteredURLs[u] = rule
+	}
+
+	for u, reason := range s.LimitedURLs {
+		g.limitedURLs[u] = reason
+	}
+
+	for u, t := range s.LastMod {
+		g.lastMod[u] = t
+	}
+
+	for u, p := range s.Pages {
+		g.pages[u] = p
+	}
+
+	for u, attempts := range s.Attempts {
+		for _, sa := range attempts {
+			a := Attempt{At: sa.At, Retry: sa.Retry}
+			if sa.Err != "" {
+				a.Err = errors.New(sa.Err)
+			}
+
+			g.attempts[u] = append(g.attempts[u], a)
+		}
+	}
+
+	for _, r := range s.Retries {
+		u, err := url.Parse(r.URL)
+		if err != nil {
+			continue
+		}
+
+		g.retryQueue = append(g.retryQueue, &retryURL{depth: r.Depth, u: u, source: r.Source, at: r.At})
+		scheduleWake(g, time.Until(r.At))
+	}
+
+	// urls crawled count towards the limits again. urls only recorded at their depth are not crawled
+	admit := func(raw string) {
+		if u, err := url.Parse(raw); err == nil {
+			admitPage(g.admitted, u)
+			admitVariant(g.admitted, u)
+		}
+	}
+
+	for u := range g.scrappedUnique {
+		admit(u)
+	}
+
+	for u := range g.pages {
+		admit(u)
+	}
+
+	for _, urls := range frontierURLs(g.unScrapped) {
+		for _, u := range urls {
+			admitVariant(g.admitted, u)
+		}
+	}
+
+	for _, r := range g.retryQueue {
+		admitVariant(g.admitted, r.u)
+	}
+}
+
+// checkpoint saves the current state of the crawl to the store if any
+func checkpoint(g *gru) {
+	if g.store == nil {
+		return
+	}
+
+	err := g.store.Save(snapshotState(g))
+	if err != nil {
+		log.Printf("failed to save crawl state: %v\n", err)
+		return
+	}
+
+	log.Println("saved crawl state...")
+}
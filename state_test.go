@@ -0,0 +1,178 @@
+package scrape
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	fs := FileStore(filepath.Join(t.TempDir(), "state.json"))
+	s, err := fs.Load()
+	if err != nil || s != nil {
+		t.Fatalf("expected no state but got %v: %v", s, err)
+	}
+
+	expected := &CrawlState{
+		BaseURL:     "http://test.com/",
+		Frontier:    map[int][]string{1: {"http://test.com/1"}},
+		UniqueURLs:  map[string]int{"http://test.com/": 1},
+		ErrorURLs:   map[string]string{"http://test.com/2": "failed"},
+		CheckedURLs: map[string]CheckedURL{"http://other.com/": {StatusCode: 404, Err: "not found"}},
+		Links:       []Link{{Source: "http://test.com/", Target: "http://test.com/1", Kind: AnchorHref}},
+		SavedAt:     time.Now().UTC().Round(time.Second),
+	}
+
+	if err := fs.Save(expected); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+
+	s, err = fs.Load()
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+
+	if !reflect.DeepEqual(s, expected) {
+		t.Fatalf("expected %+v but got %+v", expected, s)
+	}
+}
+
+func Test_snapshotState(t *testing.T) {
+	bu, _ := url.Parse("http://test.com/")
+	u1, _ := url.Parse("http://test.com/1")
+	g := newGru(bu, -1)
+	g.scrappedUnique[bu.String()] = 1
+	g.errorURLs["http://test.com/3"] = &HTTPStatusError{URL: "http://test.com/3", Code: 500}
+	g.inFlight["http://test.com/2"] = inFlightURL{depth: 1}
+	g.inFlight["http://other.com/"] = inFlightURL{depth: 1, check: true}
+	at := time.Now().Add(time.Minute).Round(0)
+	g.retryQueue = append(g.retryQueue, &retryURL{depth: 2, u: u1, source: bu.String(), at: at})
+	g.attempts[u1.String()] = []Attempt{{At: at, Err: errors.New("503"), Retry: time.Minute}}
+
+	// found at max depth and never crawled
+	deep, _ := url.Parse("http://test.com/deep")
+	g.scrapped[0] = []*url.URL{bu, deep}
+
+	s := snapshotState(g)
+	if !reflect.DeepEqual(s.Frontier, map[int][]string{1: {"http://test.com/2"}}) {
+		t.Fatalf("unexpected frontier: %v", s.Frontier)
+	}
+
+	expected := []RetryURL{{URL: u1.String(), Depth: 2, Source: bu.String(), At: at}}
+	if !reflect.DeepEqual(s.Retries, expected) || len(s.Attempts[u1.String()]) != 1 {
+		t.Fatalf("unexpected retries %v and attempts %v", s.Retries, s.Attempts)
+	}
+
+	if !reflect.DeepEqual(s.Checks, map[int][]string{1: {"http://other.com/"}}) {
+		t.Fatalf("unexpected checks: %v", s.Checks)
+	}
+
+	rg := newGru(bu, -1)
+	restoreState(rg, s)
+	frontier := frontierURLs(rg.unScrapped)
+	if !rg.resumed || len(frontier[1]) != 1 || !rg.checkQueued["http://other.com/"] {
+		t.Fatalf("unexpected restored frontier: %v %v", frontier, rg.checkQueued)
+	}
+
+	if len(rg.retryQueue) != 1 || rg.retryQueue[0].u.String() != u1.String() || rg.retryQueue[0].depth != 2 ||
+		rg.retryQueue[0].source != bu.String() || !rg.retryQueue[0].at.Equal(at) {
+		t.Fatalf("unexpected restored retries: %+v", rg.retryQueue[0])
+	}
+
+	if a := rg.attempts[u1.String()]; len(a) != 1 || a[0].Err.Error() != "503" || a[0].Retry != time.Minute {
+		t.Fatalf("unexpected restored attempts: %v", a)
+	}
+
+	if !rg.admitted.pages[bu.String()] || rg.admitted.pages[deep.String()] {
+		t.Fatalf("expected only the crawled urls to be admitted but got %v", rg.admitted.pages)
+	}
+
+	if rg.errorURLs["http://test.com/3"].Error() != g.errorURLs["http://test.com/3"].Error() {
+		t.Fatalf("unexpected restored errors: %v", rg.errorURLs)
+	}
+}
+
+// memoryStore holds the state in memory
+type memoryStore struct {
+	state *CrawlState
+	saves int
+}
+
+func (ms *memoryStore) Load() (*CrawlState, error) { return ms.state, nil }
+
+func (ms *memoryStore) Save(s *CrawlState) error {
+	ms.state = s
+	ms.saves++
+	return nil
+}
+
+func TestCrawler_RunResume(t *testing.T) {
+	ts := testServer()
+	defer ts.Close()
+
+	ms := &memoryStore{state: &CrawlState{
+		BaseURL:    ts.URL + "/",
+		Frontier:   map[int][]string{1: {ts.URL + "/3"}},
+		UniqueURLs: map[string]int{ts.URL + "/": 1, ts.URL + "/1": 1, ts.URL + "/2": 1},
+	}}
+
+	// seed is ignored when the store holds a state
+	resp, err := New(WithWorkers(2), WithStateStore(ms, time.Minute)).Run(context.Background(), "http://ignored.com/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resp.BaseURL.String() != ts.URL+"/" || len(resp.UniqueURLs) != 4 || resp.UniqueURLs[ts.URL+"/"] != 2 {
+		t.Fatalf("expected only %s/3 to be crawled but got %v", ts.URL, resp.UniqueURLs)
+	}
+
+	if ms.saves < 1 || len(ms.state.Frontier) != 0 || len(ms.state.UniqueURLs) != 4 || !ms.state.Completed {
+		t.Fatalf("expected final state to be saved but got %d saves: %+v", ms.saves, ms.state)
+	}
+}
+
+func TestCrawler_RunAfterCompleted(t *testing.T) {
+	ts1, ts2 := testServer(), testServer()
+	defer ts1.Close()
+	defer ts2.Close()
+
+	// completed crawl is not resumed by the next crawl with the same store
+	store := FileStore(filepath.Join(t.TempDir(), "state.json"))
+	for _, ts := range []*httptest.Server{ts1, ts2} {
+		resp, err := New(WithStateStore(store, time.Minute)).Run(context.Background(), ts.URL+"/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if resp.BaseURL.String() != ts.URL+"/" || len(resp.UniqueURLs) != 4 || resp.UniqueURLs[ts.URL+"/"] < 1 {
+			t.Fatalf("expected %s to be crawled but got %s with %v", ts.URL, resp.BaseURL, resp.UniqueURLs)
+		}
+	}
+}
+
+func TestCrawler_RunInterrupted(t *testing.T) {
+	ts := testServer()
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ms := &memoryStore{}
+	resp, err := New(WithStateStore(ms, time.Minute)).Run(ctx, ts.URL+"/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !resp.Interrupted {
+		t.Fatal("expected crawl to be interrupted")
+	}
+
+	// seed is either queued or in flight when interrupted
+	if urls := ms.state.Frontier[0]; !reflect.DeepEqual(urls, []string{ts.URL + "/"}) {
+		t.Fatalf("expected seed to be saved to the frontier but got %v", ms.state.Frontier)
+	}
+}
@@ -9,8 +9,8 @@ import (
 	"golang.org/x/net/html"
 )
 
-//resolveURL returns an absolute url of the extracted href
-//returns default string value of failed to resolve to absolute
+// resolveURL returns an absolute url of the extracted href
+// returns default string value of failed to resolve to absolute
 func resolveURL(baseURL *url.URL, href string) (*url.URL, error) {
 
 	uri, err := url.Parse(href)
@@ -26,7 +26,7 @@ func resolveURL(baseURL *url.URL, href string) (*url.URL, error) {
 	return uri, nil
 }
 
-//normalizeHref will remove # and query params from a given url
+// normalizeHref will remove everything from the identifier, such as #, from a given href
 func normalizeHref(href string, identifier string) string {
 	index := strings.Index(href, identifier)
 	if index == -1 {
@@ -36,52 +36,248 @@ func normalizeHref(href string, identifier string) string {
 	return href[:index]
 }
 
-//extractURLs will extract urls from anchor tags and img tags
-func extractURLs(sourceURL *url.URL, token html.Token, key string) (urls []*url.URL, invalidURLs []string) {
-	for _, attr := range token.Attr {
-		if attr.Key == key {
-			href := normalizeHref(strings.TrimSpace(attr.Val), "#")
-			if href == "" {
-				invalidURLs = append(invalidURLs, attr.Val)
-				continue
-			}
+// extractedLink is a link extracted from the page along with where it is found
+type extractedLink struct {
+	raw      string   // raw href as found in the page
+	url      *url.URL // url the link points to
+	kind     LinkKind // kind of the link
+	text     string   // text of the anchor
+	tag      string   // tag the link is found in
+	attr     string   // attr of the tag holding the link
+	rel      string   // rel attribute of the tag
+	hreflang string   // hreflang attribute of the tag
+	nofollow bool     // nofollow is true if the link or the page asks not to follow it
+}
 
-			uri, err := resolveURL(sourceURL, href)
-			if err != nil {
-				invalidURLs = append(invalidURLs, href)
-				continue
-			}
+// extractedPage holds the links and relations extracted from a page
+type extractedPage struct {
+	links       []*extractedLink // links extracted from the page
+	invalidURLs []string         // invalidURLs couldn't be resolved
+	relations   *PageRelations   // relations declared by the page. nil if none
+	noindex     bool             // noindex is true if the page asks not to be indexed through meta robots
+}
 
-			urls = append(urls, uri)
+// resolveHref resolves the raw href found in the page to an absolute url
+// returns the invalid href if failed to resolve
+func resolveHref(sourceURL *url.URL, raw string) (*url.URL, string) {
+	href := normalizeHref(strings.TrimSpace(raw), "#")
+	if href == "" {
+		return nil, raw
+	}
+
+	uri, err := resolveURL(sourceURL, href)
+	if err != nil {
+		return nil, href
+	}
+
+	return uri, ""
+}
+
+// hasToken says if the space separated list of tokens, such as rel, has the token
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
 		}
 	}
 
-	return urls, invalidURLs
+	return false
 }
 
-//extractURLsFromHTML extracts all href urls inside a tags from an html
-//does not close the reader when done
-func extractURLsFromHTML(sourceURL *url.URL, httpBody io.Reader) (urls []*url.URL, invalidURLs []string) {
+// robotsNoindex says if the X-Robots-Tag header values ask not to index the page
+func robotsNoindex(values []string) bool {
+	for _, v := range values {
+		v = strings.Replace(v, ",", " ", -1)
+		if hasToken(v, "noindex") || hasToken(v, "none") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// extractPage extracts the links of given kinds along with the anchor text and the relations declared by the page.
+// links are resolved against <base href> if present. nil kinds extracts all
+// does not close the reader when done
+func extractPage(sourceURL *url.URL, httpBody io.Reader, kinds map[LinkKind]bool) *extractedPage {
+	var raw, rels []*extractedLink
+	add := func(kind LinkKind, token html.Token, attr string, hrefs []string) (added []*extractedLink) {
+		if kinds != nil && !kinds[kind] {
+			return nil
+		}
+
+		for _, href := range hrefs {
+			l := &extractedLink{raw: href, kind: kind, tag: token.Data, attr: attr, rel: attrValue(token, "rel")}
+			raw = append(raw, l)
+			added = append(added, l)
+		}
+
+		return added
+	}
+
+	base := sourceURL
+	baseFound := false
+	metaNofollow, metaNoindex := false, false
 	page := html.NewTokenizer(httpBody)
+	var anchor []*extractedLink
+	var text []string
+	inStyle := false
 	for {
 		tokenType := page.Next()
-		if tokenType == html.ErrorToken {
-			return urls, invalidURLs
-		}
+		switch tokenType {
+		case html.ErrorToken:
+			p := resolvePage(base, raw, rels, metaNofollow)
+			p.noindex = metaNoindex
+			return p
+
+		case html.TextToken:
+			if inStyle {
+				add(CSSURL, html.Token{Data: "style"}, "", cssURLs(string(page.Text())))
+				continue
+			}
+
+			if anchor != nil {
+				text = append(text, string(page.Text()))
+			}
 
-		if tokenType == html.StartTagToken ||
-			tokenType == html.SelfClosingTagToken {
+		case html.EndTagToken:
+			name, _ := page.TagName()
+			switch string(name) {
+			case "a":
+				t := strings.Join(strings.Fields(strings.Join(text, " ")), " ")
+				for _, l := range anchor {
+					l.text = t
+				}
 
+				anchor, text = nil, nil
+			case "style":
+				inStyle = false
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
 			token := page.Token()
+			tag := token.Data
+			var added []*extractedLink
+			for _, attr := range token.Attr {
+				if attr.Key == "style" {
+					add(CSSURL, token, attr.Key, cssURLs(attr.Val))
+					continue
+				}
+
+				kind, ok := linkAttrs[tag][attr.Key]
+				if !ok {
+					continue
+				}
+
+				hrefs := []string{attr.Val}
+				if kind == ImgSrcset || kind == SourceSrcset {
+					hrefs = parseSrcset(attr.Val)
+				}
+
+				added = append(added, add(kind, token, attr.Key, hrefs)...)
+			}
+
+			if rel := attrValue(token, "rel"); rel != "" && (tag == "a" || tag == "link") {
+				rels = append(rels, &extractedLink{
+					raw:      attrValue(token, "href"),
+					rel:      rel,
+					hreflang: attrValue(token, "hreflang"),
+				})
+			}
 
-			switch token.DataAtom.String() {
+			switch tag {
 			case "a":
-				s, ius := extractURLs(sourceURL, token, "href")
-				urls = append(urls, s...)
-				invalidURLs = append(invalidURLs, ius...)
+				anchor, text = nil, nil
+				if tokenType == html.StartTagToken {
+					anchor = added
+				}
+			case "base":
+				// first base with href applies to the whole document
+				if href := attrValue(token, "href"); href != "" && !baseFound {
+					if u, _ := resolveHref(sourceURL, href); u != nil {
+						base, baseFound = u, true
+					}
+				}
+			case "meta":
+				if strings.EqualFold(attrValue(token, "name"), "robots") {
+					content := strings.Replace(attrValue(token, "content"), ",", " ", -1)
+					metaNofollow = metaNofollow || hasToken(content, "nofollow")
+					metaNoindex = metaNoindex || hasToken(content, "noindex") || hasToken(content, "none")
+					continue
+				}
+
+				if !strings.EqualFold(attrValue(token, "http-equiv"), "refresh") {
+					continue
+				}
+
+				if href, ok := parseMetaRefresh(attrValue(token, "content")); ok {
+					add(MetaRefresh, token, "content", []string{href})
+				}
+			case "style":
+				inStyle = tokenType == html.StartTagToken
+			}
+		}
+	}
+}
+
+// resolvePage resolves the raw links and relations against the base url
+func resolvePage(base *url.URL, raw, rels []*extractedLink, nofollow bool) *extractedPage {
+	p := &extractedPage{}
+	for _, l := range raw {
+		uri, invalid := resolveHref(base, l.raw)
+		if uri == nil {
+			p.invalidURLs = append(p.invalidURLs, invalid)
+			continue
+		}
+
+		l.url = uri
+		l.nofollow = nofollow || hasToken(l.rel, "nofollow")
+		p.links = append(p.links, l)
+	}
+
+	r := &PageRelations{}
+	found := false
+	for _, l := range rels {
+		uri, _ := resolveHref(base, l.raw)
+		if uri == nil {
+			continue
+		}
+
+		found = true
+		switch {
+		case hasToken(l.rel, "canonical"):
+			r.Canonical = uri.String()
+		case hasToken(l.rel, "next"):
+			r.Next = uri.String()
+		case hasToken(l.rel, "prev"), hasToken(l.rel, "previous"):
+			r.Prev = uri.String()
+		case hasToken(l.rel, "alternate") && l.hreflang != "":
+			if r.Alternates == nil {
+				r.Alternates = make(map[string]string)
 			}
+
+			r.Alternates[l.hreflang] = uri.String()
+		default:
+			found = false
+		}
+
+		if found {
+			p.relations = r
 		}
 	}
+
+	return p
+}
+
+// attrValue returns the value of the attribute of the token
+func attrValue(token html.Token, key string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+
+	return ""
 }
 
 // urlsToStr coverts []*url.URL to []string
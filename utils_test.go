@@ -7,7 +7,7 @@ import (
 	"testing"
 )
 
-func Test_extractLinksFromHTML(t *testing.T) {
+func Test_extractPageAnchors(t *testing.T) {
 	cases := []struct {
 		rawHTML       string
 		sourceURL     string
@@ -51,18 +51,18 @@ func Test_extractLinksFromHTML(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		urls, failedURLs := extractURLsFromHTML(sourceURL, bytes.NewReader([]byte(c.rawHTML)))
+		p := extractPage(sourceURL, bytes.NewReader([]byte(c.rawHTML)), kindsToSet([]LinkKind{AnchorHref}))
 		var strURLs []string
-		for _, u := range urls {
-			strURLs = append(strURLs, u.String())
+		for _, l := range p.links {
+			strURLs = append(strURLs, l.url.String())
 		}
 
 		if !reflect.DeepEqual(c.expectedLinks, strURLs) {
-			t.Fatalf("expected resolved urls %v but got %v", c.expectedLinks, urls)
+			t.Fatalf("expected resolved urls %v but got %v", c.expectedLinks, strURLs)
 		}
 
-		if !reflect.DeepEqual(c.failedURLs, failedURLs) {
-			t.Fatalf("expected failed urls %v but got %v", c.failedURLs, failedURLs)
+		if !reflect.DeepEqual(c.failedURLs, p.invalidURLs) {
+			t.Fatalf("expected failed urls %v but got %v", c.failedURLs, p.invalidURLs)
 		}
 	}
 
@@ -135,3 +135,103 @@ func Test_resolveURL(t *testing.T) {
 		}
 	}
 }
+
+func Test_extractLinksWithAnchorText(t *testing.T) {
+	rawHTML := `<a href="/1">  Page
+	<b>One</b> </a>
+<a href="/2"/>
+<p>outside</p>
+<a href="#">Hash</a>
+<a href="/3"><img src="/logo.png">Three</a>`
+
+	sourceURL, _ := url.Parse("http://www.test.com")
+	p := extractPage(sourceURL, bytes.NewReader([]byte(rawHTML)), kindsToSet([]LinkKind{AnchorHref}))
+	links, invalidURLs := p.links, p.invalidURLs
+	expected := []extractedLink{
+		{text: "Page One", kind: AnchorHref, tag: "a", attr: "href"},
+		{kind: AnchorHref, tag: "a", attr: "href"},
+		{text: "Three", kind: AnchorHref, tag: "a", attr: "href"},
+	}
+	expectedURLs := []string{"http://www.test.com/1", "http://www.test.com/2", "http://www.test.com/3"}
+
+	if len(links) != len(expected) {
+		t.Fatalf("expected %d links but got %d", len(expected), len(links))
+	}
+
+	for i, l := range links {
+		if l.url.String() != expectedURLs[i] || l.text != expected[i].text || l.kind != expected[i].kind || l.tag != expected[i].tag || l.attr != expected[i].attr {
+			t.Fatalf("expected %s %+v but got %s %+v", expectedURLs[i], expected[i], l.url, *l)
+		}
+	}
+
+	if !reflect.DeepEqual(invalidURLs, []string{"#"}) {
+		t.Fatalf("unexpected invalid urls: %v", invalidURLs)
+	}
+}
+
+func Test_extractPage(t *testing.T) {
+	tests := []struct {
+		html      string
+		urls      []string
+		nofollow  []bool
+		relations *PageRelations
+	}{
+		{
+			html:     `<a href="1">One</a><base href="/docs/"><a href="2">Two</a><a href="3" rel="nofollow">Three</a>`,
+			urls:     []string{"http://www.test.com/docs/1", "http://www.test.com/docs/2", "http://www.test.com/docs/3"},
+			nofollow: []bool{false, false, true},
+		},
+
+		{
+			html:     `<base href="http://cdn.test.com/a/"><base href="/ignored/"><a href="1">One</a>`,
+			urls:     []string{"http://cdn.test.com/a/1"},
+			nofollow: []bool{false},
+		},
+
+		{
+			html:     `<meta name="robots" content="noindex, nofollow"><a href="/1">One</a>`,
+			urls:     []string{"http://www.test.com/1"},
+			nofollow: []bool{true},
+		},
+
+		{
+			html: `<base href="/docs/">
+<link rel="canonical" href="page">
+<link rel="next" href="page?p=2">
+<link rel="prev" href="page?p=0">
+<link rel="alternate" hreflang="fr" href="/fr/page">
+<link rel="alternate" type="application/rss+xml" href="/feed">`,
+			urls:     []string{"http://www.test.com/docs/page", "http://www.test.com/docs/page?p=2", "http://www.test.com/docs/page?p=0", "http://www.test.com/fr/page", "http://www.test.com/feed"},
+			nofollow: []bool{false, false, false, false, false},
+			relations: &PageRelations{
+				Canonical:  "http://www.test.com/docs/page",
+				Next:       "http://www.test.com/docs/page?p=2",
+				Prev:       "http://www.test.com/docs/page?p=0",
+				Alternates: map[string]string{"fr": "http://www.test.com/fr/page"},
+			},
+		},
+	}
+
+	sourceURL, _ := url.Parse("http://www.test.com/index.html")
+	for _, c := range tests {
+		p := extractPage(sourceURL, bytes.NewReader([]byte(c.html)), nil)
+		var urls []string
+		var nofollow []bool
+		for _, l := range p.links {
+			urls = append(urls, l.url.String())
+			nofollow = append(nofollow, l.nofollow)
+		}
+
+		if !reflect.DeepEqual(urls, c.urls) {
+			t.Fatalf("expected %v but got %v", c.urls, urls)
+		}
+
+		if !reflect.DeepEqual(nofollow, c.nofollow) {
+			t.Fatalf("expected nofollow %v but got %v", c.nofollow, nofollow)
+		}
+
+		if !reflect.DeepEqual(p.relations, c.relations) {
+			t.Fatalf("expected relations %+v but got %+v", c.relations, p.relations)
+		}
+	}
+}